@@ -0,0 +1,495 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	contract "dappmeetingnew/constract"
+	"dappmeetingnew/handle"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// runCommand runs a maintenance command given on the command line
+func runCommand(name string, args []string) error {
+	switch name {
+	case "signer-standin":
+		return runSignerStandin(args)
+	case "gas-report":
+		return runGasReport(args)
+	case "index-query":
+		return runIndexQuery(args)
+	case "index-reindex":
+		return runIndexReindex(args)
+	case "attendance":
+		return runAttendance(args)
+	case "webhook-log":
+		return runWebhookLog(args)
+	case "webhook-replay":
+		return runWebhookReplay(args)
+	case "message-schemas":
+		return runMessageSchemas(args)
+	case "dead-letters":
+		return runDeadLetters(args)
+	default:
+		return fmt.Errorf("unknown command: %s", name)
+	}
+}
+
+// runSignerStandin serves a clef-compatible signer API backed by the configured
+// raw or keystore signer, for running the external signer backend locally
+func runSignerStandin(args []string) error {
+	fs := flag.NewFlagSet("signer-standin", flag.ExitOnError)
+	listen := fs.String("listen", "127.0.0.1:8550", "address to serve the signer JSON-RPC API on")
+	fs.Parse(args)
+
+	cfg := signerConfig()
+	if cfg.Backend == handle.SignerBackendExternal {
+		return fmt.Errorf("the stand-in needs a raw or keystore signer backend")
+	}
+
+	signer, err := handle.NewSigner(cfg)
+	if err != nil {
+		return err
+	}
+
+	server, err := handle.NewLocalSignerServer(signer)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Signer stand-in for %s listening on http://%s", signer.Address().Hex(), *listen)
+	return http.ListenAndServe(*listen, server)
+}
+
+// runGasReport aggregates the gas ledger and exports it as CSV or JSON
+func runGasReport(args []string) error {
+	fs := flag.NewFlagSet("gas-report", flag.ExitOnError)
+	groupBy := fs.String("by", "room,participant,type,day", "comma separated grouping: room, participant, type, day")
+	format := fs.String("format", "csv", "output format: csv or json")
+	from := fs.String("from", "", "only include transactions on or after this date (YYYY-MM-DD)")
+	to := fs.String("to", "", "only include transactions before this date (YYYY-MM-DD)")
+	output := fs.String("out", "", "output file, defaults to stdout")
+	fs.Parse(args)
+
+	fromTime, err := parseDateFlag(*from)
+	if err != nil {
+		return err
+	}
+	toTime, err := parseDateFlag(*to)
+	if err != nil {
+		return err
+	}
+
+	db, err := handle.OpenDatabase(databasePath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ledger, err := handle.NewGasLedger(db)
+	if err != nil {
+		return err
+	}
+	entries, err := ledger.Entries(fromTime, toTime)
+	if err != nil {
+		return err
+	}
+
+	rows, err := handle.BuildGasReport(entries, splitList(*groupBy))
+	if err != nil {
+		return err
+	}
+
+	w, closeOutput, err := openOutput(*output)
+	if err != nil {
+		return err
+	}
+	defer closeOutput()
+
+	switch *format {
+	case "csv":
+		return handle.WriteGasReportCSV(w, rows)
+	case "json":
+		return handle.WriteGasReportJSON(w, rows)
+	default:
+		return fmt.Errorf("unknown format: %s", *format)
+	}
+}
+
+// parseDateFlag parses a YYYY-MM-DD flag value, returning the zero time when empty
+func parseDateFlag(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q: %v", value, err)
+	}
+	return t, nil
+}
+
+// openOutput opens the named output file, or stdout when the name is empty
+func openOutput(path string) (io.Writer, func(), error) {
+	if path == "" {
+		return os.Stdout, func() {}, nil
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create %s: %v", path, err)
+	}
+	return file, func() { file.Close() }, nil
+}
+
+// dialContract connects to the Ethereum node and binds the meeting contract
+func dialContract() (*ethclient.Client, *contract.Contract, error) {
+	client, err := ethclient.Dial(ethereumNodeURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to the Ethereum network: %v", err)
+	}
+	contractInstance, err := contract.NewContract(common.HexToAddress(contractAddress), client)
+	if err != nil {
+		client.Close()
+		return nil, nil, fmt.Errorf("failed to instantiate contract: %v", err)
+	}
+	return client, contractInstance, nil
+}
+
+// openIndexer opens the database and the event indexer without a chain connection
+func openIndexer(client *ethclient.Client, contractInstance *contract.Contract) (*handle.EventIndexer, func(), error) {
+	db, err := handle.OpenDatabase(databasePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	indexer, err := handle.NewEventIndexer(db, client, contractInstance)
+	if err != nil {
+		db.Close()
+		return nil, nil, err
+	}
+	return indexer, func() { db.Close() }, nil
+}
+
+// runIndexQuery prints indexed events filtered by room, wallet, event name and time range
+func runIndexQuery(args []string) error {
+	fs := flag.NewFlagSet("index-query", flag.ExitOnError)
+	room := fs.String("room", "", "room ID")
+	wallet := fs.String("wallet", "", "participant or sender wallet address")
+	event := fs.String("event", "", "comma separated contract event names")
+	from := fs.String("from", "", "only include events on or after this date (YYYY-MM-DD)")
+	to := fs.String("to", "", "only include events before this date (YYYY-MM-DD)")
+	limit := fs.Int("limit", 0, "maximum number of events, 0 for all")
+	format := fs.String("format", "json", "output format: csv or json")
+	output := fs.String("out", "", "output file, defaults to stdout")
+	fs.Parse(args)
+
+	query := handle.EventQuery{
+		RoomID:     *room,
+		Wallet:     *wallet,
+		EventNames: splitList(*event),
+		Limit:      *limit,
+	}
+	var err error
+	if query.From, err = parseDateFlag(*from); err != nil {
+		return err
+	}
+	if query.To, err = parseDateFlag(*to); err != nil {
+		return err
+	}
+
+	indexer, closeIndexer, err := openIndexer(nil, nil)
+	if err != nil {
+		return err
+	}
+	defer closeIndexer()
+
+	events, err := indexer.Query(query)
+	if err != nil {
+		return err
+	}
+	if events == nil {
+		events = []handle.IndexedEvent{}
+	}
+
+	w, closeOutput, err := openOutput(*output)
+	if err != nil {
+		return err
+	}
+	defer closeOutput()
+
+	switch *format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(events)
+	case "csv":
+		writer := csv.NewWriter(w)
+		writer.Write([]string{"block_time", "block_number", "tx_hash", "log_index", "event_name", "room_id", "wallet", "message_type", "track_name", "session_id"})
+		for _, e := range events {
+			writer.Write([]string{
+				e.BlockTime.Format(time.RFC3339),
+				strconv.FormatUint(e.BlockNumber, 10),
+				e.TxHash,
+				strconv.FormatUint(uint64(e.LogIndex), 10),
+				e.EventName,
+				e.RoomID,
+				e.Wallet,
+				e.MessageType,
+				e.TrackName,
+				e.SessionID,
+			})
+		}
+		writer.Flush()
+		return writer.Error()
+	default:
+		return fmt.Errorf("unknown format: %s", *format)
+	}
+}
+
+// runIndexReindex re-reads the contract events of a block range into the index
+func runIndexReindex(args []string) error {
+	fs := flag.NewFlagSet("index-reindex", flag.ExitOnError)
+	from := fs.Uint64("from", 0, "first block of the range")
+	to := fs.Uint64("to", 0, "last block of the range, defaults to the latest block")
+	fs.Parse(args)
+
+	client, contractInstance, err := dialContract()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	indexer, closeIndexer, err := openIndexer(client, contractInstance)
+	if err != nil {
+		return err
+	}
+	defer closeIndexer()
+
+	end := *to
+	if end == 0 {
+		if end, err = client.BlockNumber(context.Background()); err != nil {
+			return fmt.Errorf("failed to read latest block: %v", err)
+		}
+	}
+
+	count, err := indexer.Reindex(context.Background(), *from, end)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Reindexed %d events in blocks %d-%d\n", count, *from, end)
+	return nil
+}
+
+// runAttendance exports the attendance report of a room as CSV or JSON
+func runAttendance(args []string) error {
+	fs := flag.NewFlagSet("attendance", flag.ExitOnError)
+	room := fs.String("room", "", "room ID")
+	from := fs.String("from", "", "only include joins and leaves on or after this date (YYYY-MM-DD)")
+	to := fs.String("to", "", "only include joins and leaves before this date (YYYY-MM-DD)")
+	end := fs.String("end", "", "session end (RFC 3339) for participants without a leave, defaults to the last room event")
+	format := fs.String("format", "csv", "output format: csv or json")
+	output := fs.String("out", "", "output file, defaults to stdout")
+	fs.Parse(args)
+
+	query := handle.AttendanceQuery{RoomID: *room}
+	var err error
+	if query.From, err = parseDateFlag(*from); err != nil {
+		return err
+	}
+	if query.To, err = parseDateFlag(*to); err != nil {
+		return err
+	}
+	if *end != "" {
+		if query.SessionEnd, err = time.Parse(time.RFC3339, *end); err != nil {
+			return fmt.Errorf("invalid session end %q: %v", *end, err)
+		}
+	}
+
+	indexer, closeIndexer, err := openIndexer(nil, nil)
+	if err != nil {
+		return err
+	}
+	defer closeIndexer()
+
+	report, err := indexer.Attendance(query)
+	if err != nil {
+		return err
+	}
+
+	w, closeOutput, err := openOutput(*output)
+	if err != nil {
+		return err
+	}
+	defer closeOutput()
+
+	switch *format {
+	case "csv":
+		return handle.WriteAttendanceCSV(w, report)
+	case "json":
+		return handle.WriteAttendanceJSON(w, report)
+	default:
+		return fmt.Errorf("unknown format: %s", *format)
+	}
+}
+
+// openWebhooks loads the webhook subscriptions and creates their dispatcher on the database
+func openWebhooks(db *sql.DB) (*handle.WebhookDispatcher, error) {
+	if webhookConfigPath == "" {
+		return nil, fmt.Errorf("WEBHOOK_CONFIG is not set")
+	}
+	subscriptions, err := handle.LoadWebhookSubscriptions(webhookConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	return handle.NewWebhookDispatcher(db, subscriptions, webhookMaxAttempts)
+}
+
+// runWebhookLog prints the webhook delivery log
+func runWebhookLog(args []string) error {
+	fs := flag.NewFlagSet("webhook-log", flag.ExitOnError)
+	status := fs.String("status", "", "only show deliveries with this status: pending, delivered or failed")
+	limit := fs.Int("limit", 100, "maximum number of deliveries")
+	fs.Parse(args)
+
+	db, err := handle.OpenDatabase(databasePath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	webhooks, err := openWebhooks(db)
+	if err != nil {
+		return err
+	}
+
+	deliveries, err := webhooks.Deliveries(*status, *limit)
+	if err != nil {
+		return err
+	}
+	if deliveries == nil {
+		deliveries = []handle.WebhookDelivery{}
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(deliveries)
+}
+
+// runWebhookReplay sends a logged delivery again, or re-queues all failed deliveries
+func runWebhookReplay(args []string) error {
+	fs := flag.NewFlagSet("webhook-replay", flag.ExitOnError)
+	id := fs.Int64("id", 0, "delivery ID to send again")
+	failed := fs.Bool("failed", false, "re-queue every failed delivery for the running backend to retry")
+	fs.Parse(args)
+
+	if *id == 0 && !*failed {
+		return fmt.Errorf("either -id or -failed is required")
+	}
+
+	db, err := handle.OpenDatabase(databasePath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	webhooks, err := openWebhooks(db)
+	if err != nil {
+		return err
+	}
+
+	if *failed {
+		count, err := webhooks.ReplayFailed()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Re-queued %d failed deliveries\n", count)
+		return nil
+	}
+
+	if err := webhooks.Replay(*id); err != nil {
+		return err
+	}
+	fmt.Printf("Delivery %d sent\n", *id)
+	return nil
+}
+
+// runMessageSchemas writes the JSON Schema documents of the frontend/backend messages
+func runMessageSchemas(args []string) error {
+	fs := flag.NewFlagSet("message-schemas", flag.ExitOnError)
+	output := fs.String("out", "../documents/schemas", "directory to write the schema files to")
+	fs.Parse(args)
+
+	written, err := handle.WriteMessageSchemas(*output)
+	if err != nil {
+		return err
+	}
+	for _, path := range written {
+		fmt.Println("Wrote", path)
+	}
+	return nil
+}
+
+// runDeadLetters lists, shows, retries or discards events whose handling failed
+func runDeadLetters(args []string) error {
+	fs := flag.NewFlagSet("dead-letters", flag.ExitOnError)
+	status := fs.String("status", "", "only list dead letters with this status: pending, retry_requested, resolved or discarded")
+	limit := fs.Int("limit", 100, "maximum number of dead letters to list")
+	show := fs.Int64("show", 0, "dead letter ID to show with its completed steps")
+	retry := fs.Int64("retry", 0, "dead letter ID for the running backend to retry")
+	discard := fs.Int64("discard", 0, "dead letter ID to drop")
+	fs.Parse(args)
+
+	db, err := handle.OpenDatabase(databasePath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	deadLetters, err := handle.NewDeadLetterStore(db)
+	if err != nil {
+		return err
+	}
+
+	var result interface{}
+	switch {
+	case *retry != 0:
+		if err := deadLetters.RequestRetry(*retry); err != nil {
+			return err
+		}
+		fmt.Printf("Dead letter %d queued for retry\n", *retry)
+		return nil
+	case *discard != 0:
+		if err := deadLetters.Discard(*discard); err != nil {
+			return err
+		}
+		fmt.Printf("Dead letter %d discarded\n", *discard)
+		return nil
+	case *show != 0:
+		if result, err = deadLetters.Get(*show); err != nil {
+			return err
+		}
+	default:
+		letters, err := deadLetters.List(*status, *limit)
+		if err != nil {
+			return err
+		}
+		if letters == nil {
+			letters = []handle.DeadLetter{}
+		}
+		result = letters
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(result)
+}
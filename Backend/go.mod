@@ -5,6 +5,8 @@ go 1.23.5
 require (
 	github.com/ethereum/go-ethereum v1.15.6
 	github.com/joho/godotenv v1.5.1
+	github.com/mattn/go-sqlite3 v1.14.24
+	golang.org/x/term v0.29.0
 )
 
 require (
@@ -7,6 +7,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"time"
 
 	contract "dappmeetingnew/constract"
 
@@ -14,27 +15,183 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 )
 
+// requestDedupeWindow is how long a request ID is remembered for deduplication
+const requestDedupeWindow = 30 * time.Minute
+
 // EventHandler handles events from smart contract and orchestrates backend responses
 type EventHandler struct {
 	contractInstance  *contract.Contract
 	cloudflareService *CloudflareService
 	smCallManager     *SMCallManager
+	projection        *RoomProjection
+	webhooks          *WebhookDispatcher
+	deadLetters       *DeadLetterStore
+	rateLimiter       *RateLimiter
+	sessions          *SessionRegistry
+	announced         trackAnnouncements
+	chat              *ChatStore
+	joinChatHistory   int
+	registry          *MessageRegistry
 }
 
 // NewEventHandler creates a new event handler
 func NewEventHandler(contractInstance *contract.Contract, cloudflareService *CloudflareService, smCallManager *SMCallManager) *EventHandler {
-	return &EventHandler{
+	h := &EventHandler{
 		contractInstance:  contractInstance,
 		cloudflareService: cloudflareService,
 		smCallManager:     smCallManager,
+		registry:          NewMessageRegistry(),
 	}
+	h.registry.Use(LoggingMiddleware(), DedupeMiddleware(requestDedupeWindow))
+	h.registerBuiltinMessages()
+	return h
+}
+
+// Registry returns the registry of EventForwardedToBackend message types, for adding custom types and middleware
+func (h *EventHandler) Registry() *MessageRegistry {
+	return h.registry
+}
+
+// frontendNotifications are the message types the frontend sends for its own bookkeeping.
+// They need no handling and are ignored without a reply, which would cost a transaction.
+var frontendNotifications = map[string]bool{
+	"notification":        true,
+	"track-pull-complete": true,
+}
+
+// registerBuiltinMessages registers the media message types handled by the backend
+func (h *EventHandler) registerBuiltinMessages() {
+	Register(h.registry, "publish-track", DecodeStrict[PublishTrackRequest], h.handlePublishTrack)
+	Register(h.registry, "pull-track", DecodeStrict[PullTrackRequest], h.handlePullTrack)
+	Register(h.registry, "close-track", DecodeStrict[CloseTrackRequest], h.handleCloseTrack)
+	Register(h.registry, "renegotiation", DecodeStrict[RenegotiationRequest], h.handleRenegotiation)
+	Register(h.registry, "set-layer", DecodeStrict[SetLayerRequest], h.handleSetLayer)
+	Register(h.registry, "publish-datachannel", DecodeStrict[PublishDataChannelRequest], h.handlePublishDataChannel)
+	Register(h.registry, "subscribe-datachannel", DecodeStrict[SubscribeDataChannelRequest], h.handleSubscribeDataChannel)
+	Register(h.registry, "ice-restart", DecodeStrict[IceRestartRequest], h.handleIceRestart)
+	Register(h.registry, "broadcast", DecodeStrict[BroadcastRequest], h.handleBroadcast)
+	Register(h.registry, "chat-send", DecodeStrict[ChatSendRequest], h.handleChatSend)
+	Register(h.registry, "chat-history", DecodeStrict[ChatHistoryRequest], h.handleChatHistory)
+}
+
+// SetProjection lets the handler answer room state questions from the event projection
+func (h *EventHandler) SetProjection(projection *RoomProjection) {
+	h.projection = projection
+}
+
+// recordTrack tells the projection the mid and location of a track the backend added for the sender
+func (h *EventHandler) recordTrack(ctx *MessageContext, sessionID, trackName, mid, location string) {
+	if h.projection == nil {
+		return
+	}
+	h.projection.RecordTrack(ctx.RoomID, ctx.Sender, contract.DAppMeetingTrack{
+		TrackName:   trackName,
+		Mid:         mid,
+		Location:    location,
+		IsPublished: true,
+		SessionId:   sessionID,
+		RoomId:      ctx.RoomID,
+	})
+}
+
+// SetWebhooks makes the handler notify webhook subscribers once lifecycle events are processed
+func (h *EventHandler) SetWebhooks(webhooks *WebhookDispatcher) {
+	h.webhooks = webhooks
+}
+
+// SetDeadLetters keeps failed events for retry and checkpoints the handler steps of every request
+func (h *EventHandler) SetDeadLetters(deadLetters *DeadLetterStore) {
+	h.deadLetters = deadLetters
+}
+
+// SetRateLimiter limits the requests handled per sender, per room and globally
+func (h *EventHandler) SetRateLimiter(rateLimiter *RateLimiter) {
+	h.rateLimiter = rateLimiter
+}
+
+// SetSessions records the owner of every session the handler creates and rejects
+// requests on sessions the sender does not own
+func (h *EventHandler) SetSessions(sessions *SessionRegistry) {
+	h.sessions = sessions
+}
+
+// SetChat stores chat messages and attaches the latest joinHistory messages to join-room responses
+func (h *EventHandler) SetChat(chat *ChatStore, joinHistory int) {
+	h.chat = chat
+	h.joinChatHistory = joinHistory
+}
+
+// recordSession registers a session created for the sender
+func (h *EventHandler) recordSession(ctx *MessageContext, sessionID string) {
+	if h.sessions == nil {
+		return
+	}
+	if err := h.sessions.Record(sessionID, ctx.RoomID, ctx.Sender); err != nil {
+		ctx.Logf("Error recording session owner: %v", err)
+	}
+}
+
+// verifySession rejects requests on sessions the sender does not own
+func (h *EventHandler) verifySession(ctx *MessageContext, sessionID string) error {
+	if h.sessions == nil {
+		return nil
+	}
+	return h.sessions.VerifyOwner(ctx.RoomID, ctx.Sender, sessionID)
+}
+
+// publishWebhook queues a lifecycle event for webhook delivery
+func (h *EventHandler) publishWebhook(event WebhookEvent) {
+	if h.webhooks == nil {
+		return
+	}
+	if err := h.webhooks.Publish(event); err != nil {
+		log.Printf("Error publishing webhook event %s: %v", event.ID, err)
+	}
+}
+
+// joinSession is the checkpointed result of creating the session of a joining participant
+type joinSession struct {
+	SessionID          string                 `json:"sessionId"`
+	CloudflareResponse map[string]interface{} `json:"cloudflareResponse"`
 }
 
 // HandleParticipantJoined processes ParticipantJoined events
-func (h *EventHandler) HandleParticipantJoined(event *contract.ContractParticipantJoined) {
-	log.Printf("Participant Joined - Room: %s, Address: %s, Tracks: %d",
+func (h *EventHandler) HandleParticipantJoined(event *contract.ContractParticipantJoined) error {
+	return h.handleParticipantJoined(event, false)
+}
+
+// handleParticipantJoined processes a ParticipantJoined event, or retries one from the dead letters
+func (h *EventHandler) handleParticipantJoined(event *contract.ContractParticipantJoined, retry bool) error {
+	ctx := &MessageContext{
+		Context:   context.Background(),
+		RoomID:    event.RoomId,
+		Sender:    event.Participant,
+		Type:      "join-room",
+		RequestID: logRequestID(event.Raw),
+		Payload: map[string]interface{}{
+			"initialTracks":      event.InitialTracks,
+			"sessionDescription": event.SessionDescription,
+		},
+		Raw:     event.Raw,
+		handler: h,
+		retry:   retry,
+	}
+	ctx.Logf("Participant Joined - Room: %s, Address: %s, Tracks: %d",
 		event.RoomId, event.Participant.Hex(), len(event.InitialTracks))
 
+	trackNames := make([]string, len(event.InitialTracks))
+	for i, track := range event.InitialTracks {
+		trackNames[i] = track.TrackName
+	}
+	if !retry {
+		defer h.publishWebhook(NewWebhookEvent(WebhookParticipantJoined, event.RoomId, event.Participant, event.Raw,
+			map[string]interface{}{"tracks": trackNames}))
+	}
+
+	if err := h.checkRateLimit(ctx, "join-room"); err != nil {
+		return err
+	}
+
 	// Convert contract tracks to a format Cloudflare can use
 	tracks := make([]interface{}, len(event.InitialTracks))
 	for i, track := range event.InitialTracks {
@@ -47,227 +204,565 @@ func (h *EventHandler) HandleParticipantJoined(event *contract.ContractParticipa
 	}
 
 	// Process with Cloudflare service - this will create a session and publish tracks
-	sessionID, cloudflareResponse, err := h.cloudflareService.HandleParticipantEvent(
-		event.RoomId,
-		event.Participant.Hex(),
-		tracks,
-		event.SessionDescription,
-	)
+	session, err := RunStep(ctx, "create-session", func() (joinSession, error) {
+		sessionID, cloudflareResponse, err := h.cloudflareService.HandleParticipantEvent(
+			event.RoomId,
+			event.Participant.Hex(),
+			tracks,
+			event.SessionDescription,
+		)
+		return joinSession{SessionID: sessionID, CloudflareResponse: cloudflareResponse}, err
+	})
+	if err != nil {
+		return h.failRequest(ctx, EventNameParticipantJoined, h.replyError(ctx, "join-room",
+			NewMessageError(ErrCodeSessionFailed, "error processing participant event: %v", err)))
+	}
+	sessionID := session.SessionID
+	h.recordSession(ctx, sessionID)
 
+	// Update participant's session ID in the smart contract via our queue
+	_, err = RunStep(ctx, "set-session-id", func() (common.Hash, error) {
+		return h.smCallManager.SetParticipantSessionID(event.RoomId, event.Participant, sessionID)
+	})
 	if err != nil {
-		log.Printf("Error processing participant event: %v", err)
+		return h.failRequest(ctx, EventNameParticipantJoined, h.replyError(ctx, "join-room",
+			NewMessageError(ErrCodeContract, "error setting participant session ID: %v", err)))
+	}
+
+	// Forward the session back to the frontend through smart contract via our queue
+	response := JoinRoomResponse{
+		MessageHeader:      responseHeader("join-room", ctx.RequestID),
+		ResponseEnvelope:   successEnvelope("join-room"),
+		SessionID:          sessionID,
+		LegacySessionID:    sessionID,
+		CloudflareResponse: session.CloudflareResponse,
+	}
+	if h.chat != nil && h.joinChatHistory > 0 {
+		if history, _, err := h.chat.History(event.RoomId, 0, h.joinChatHistory); err != nil {
+			ctx.Logf("Error reading chat history for join response: %v", err)
+		} else {
+			response.ChatHistory = history
+		}
+	}
+	// The chat history makes the answer long, compress it like pull responses so the join does not revert
+	compress := len(response.ChatHistory) > 0
+	txHash, err := RunStep(ctx, "forward-response", func() (common.Hash, error) {
+		return h.forwardToFrontend(event.RoomId, event.Participant, response, compress)
+	})
+	if err != nil {
+		return h.failRequest(ctx, EventNameParticipantJoined,
+			NewMessageError(ErrCodeContract, "error forwarding event to frontend: %v", err))
+	}
+
+	ctx.Logf("Successfully processed join event for %s, txHash: %s", event.Participant.Hex(), txHash)
+
+	// The initial tracks were published with the session by the backend itself, announce them like publish-track does
+	h.announceTracks(ctx, event.Participant, sessionID, publishedInitialTracks(session.CloudflareResponse, event.InitialTracks))
+	h.completeRequest(ctx)
+	return nil
+}
+
+// HandleParticipantLeft processes ParticipantLeft events: it closes the tracks of every
+// session the backend created for the participant and, when tracks were closed, notifies
+// the remaining participants
+func (h *EventHandler) HandleParticipantLeft(event *contract.ContractParticipantLeft) error {
+	log.Printf("Participant Left - Room: %s, Address: %s",
+		event.RoomId, event.Participant.Hex())
+
+	h.publishWebhook(NewWebhookEvent(WebhookParticipantLeft, event.RoomId, event.Participant, event.Raw, nil))
+
+	ctx := &MessageContext{
+		Context:   context.Background(),
+		RoomID:    event.RoomId,
+		Sender:    event.Participant,
+		Type:      "participant-left",
+		RequestID: logRequestID(event.Raw),
+		Raw:       event.Raw,
+		handler:   h,
+	}
+	sessionIDs, trackNames, err := h.teardownSessions(ctx)
+	if len(trackNames) == 0 {
+		// The others pulled nothing from the participant; its ParticipantLeft event tells them it left
+		return err
+	}
+	h.notifyRoom(ctx, event.Participant, ParticipantLeftNotification{
+		MessageHeader: responseHeader("participant-left", ctx.RequestID),
+		Participant:   event.Participant.Hex(),
+		SessionIDs:    sessionIDs,
+		TrackNames:    trackNames,
+	})
+	return err
+}
+
+// NotifySessionClosed tells the owner of a session closed by the backend. The rest of the room is told
+// only when tracks were closed, since the others have nothing pulled from a session without tracks.
+func (h *EventHandler) NotifySessionClosed(owner SessionOwner, trackNames []string, reason string) {
+	ctx := &MessageContext{
+		Context:   context.Background(),
+		RoomID:    owner.RoomID,
+		Sender:    owner.Participant,
+		Type:      "session-closed",
+		RequestID: owner.SessionID,
+		handler:   h,
+	}
+	if trackNames == nil {
+		trackNames = []string{}
+	}
+	notification := SessionClosedNotification{
+		MessageHeader: responseHeader("session-closed", ctx.RequestID),
+		Participant:   owner.Participant.Hex(),
+		SessionID:     owner.SessionID,
+		TrackNames:    trackNames,
+		Reason:        reason,
+	}
+
+	if len(trackNames) > 0 {
+		h.notifyRoom(ctx, common.Address{}, notification)
 		return
 	}
 
-	// Update participant's session ID in the smart contract via our queue
-	_, err = h.smCallManager.SetParticipantSessionID(event.RoomId, event.Participant, sessionID)
+	// The owner of an expired session has often left the room, and the contract refuses to forward to it
+	opts := &bind.CallOpts{Context: context.Background()}
+	inRoom, err := h.contractInstance.ParticipantsInRoom(opts, owner.RoomID, owner.Participant)
 	if err != nil {
-		log.Printf("Error setting participant session ID: %v", err)
+		ctx.Logf("Error checking whether %s is still in the room: %v", owner.Participant.Hex(), err)
 		return
 	}
+	if !inRoom {
+		return
+	}
+	if _, err := h.forwardToFrontend(owner.RoomID, owner.Participant, notification, false); err != nil {
+		ctx.Logf("Error notifying %s of closed session: %v", owner.Participant.Hex(), err)
+	}
+}
+
+// teardownSessions force-closes the live local tracks of the sender's sessions and forgets the sessions.
+// It returns the sessions and tracks it closed, and the first failure.
+func (h *EventHandler) teardownSessions(ctx *MessageContext) ([]string, []string, error) {
+	sessionIDs, trackNames := []string{}, []string{}
+	if h.sessions == nil {
+		return sessionIDs, trackNames, nil
+	}
+	sessions, err := h.sessions.Sessions(ctx.RoomID, ctx.Sender)
+	if err != nil {
+		return sessionIDs, trackNames, fmt.Errorf("error listing sessions of %s: %v", ctx.Sender.Hex(), err)
+	}
 
-	// Prepare event data to send back to frontend
-	eventData := map[string]interface{}{
-		"sessionID":          sessionID,
-		"type":               "join-room",
-		"cloudflareResponse": cloudflareResponse,
+	var firstErr error
+	for _, sessionID := range sessions {
+		names, err := h.cloudflareService.CloseLocalTracks(sessionID)
+		if err != nil {
+			ctx.Logf("Error tearing down session %s: %v", sessionID, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if len(names) > 0 {
+			ctx.Logf("Closed %d tracks of session %s", len(names), sessionID)
+			sessionIDs = append(sessionIDs, sessionID)
+			trackNames = append(trackNames, names...)
+		}
+
+		if err := h.sessions.Remove(sessionID); err != nil {
+			ctx.Logf("%v", err)
+		}
 	}
+	return sessionIDs, trackNames, firstErr
+}
 
-	eventDataBytes, err := json.Marshal(eventData)
+// notifyRoom sends a notification to every participant of the room except one
+func (h *EventHandler) notifyRoom(ctx *MessageContext, except common.Address, notification interface{}) {
+	participants, err := h.roomParticipants(ctx.RoomID)
 	if err != nil {
-		log.Printf("Error marshaling event data: %v", err)
+		ctx.Logf("Error reading participants to notify: %v", err)
 		return
 	}
+	h.notifyParticipants(ctx, participants, except, notification)
+}
 
-	// Forward event to frontend through smart contract via our queue
-	txHash, err := h.smCallManager.ForwardEventToFrontend(event.RoomId, event.Participant, eventDataBytes)
+// notifyParticipants sends a notification to the given participants except one
+func (h *EventHandler) notifyParticipants(ctx *MessageContext, participants []contract.DAppMeetingParticipantDetails, except common.Address, notification interface{}) {
+	result, err := h.broadcastTo(ctx.RoomID, participants, notification, except)
 	if err != nil {
-		log.Printf("Error forwarding event to frontend: %v", err)
-		return
+		ctx.Logf("Error notifying room %s: %v", ctx.RoomID, err)
+	} else if len(result.Failed) > 0 {
+		ctx.Logf("Notified %d participants, %d failed", len(result.Recipients), len(result.Failed))
 	}
+}
 
-	log.Printf("Successfully processed join event for %s, txHash: %s", event.Participant.Hex(), txHash)
+// BroadcastResult lists the participants a broadcast was delivered to and those it failed for
+type BroadcastResult struct {
+	Recipients []common.Address `json:"recipients"`
+	Failed     []common.Address `json:"failed"`
 }
 
-// HandleParticipantLeft processes ParticipantLeft events
-func (h *EventHandler) HandleParticipantLeft(event *contract.ContractParticipantLeft) {
-	log.Printf("Participant Left - Room: %s, Address: %s",
-		event.RoomId, event.Participant.Hex())
+// Broadcast delivers a payload to every current participant of the room except the excluded ones.
+// The contract has no broadcast event, so the payload is fanned out as one batch of
+// ForwardEventToFrontend transactions.
+func (h *EventHandler) Broadcast(roomID string, payload interface{}, exclude ...common.Address) (BroadcastResult, error) {
+	participants, err := h.roomParticipants(roomID)
+	if err != nil {
+		return BroadcastResult{}, fmt.Errorf("error reading participants of room %s: %v", roomID, err)
+	}
+	return h.broadcastTo(roomID, participants, payload, exclude...)
+}
 
-	// Additional logic can be added here if needed
+// broadcastTo delivers a payload to the given participants except the excluded ones
+func (h *EventHandler) broadcastTo(roomID string, participants []contract.DAppMeetingParticipantDetails, payload interface{}, exclude ...common.Address) (BroadcastResult, error) {
+	recipients := broadcastRecipients(participants, exclude)
+	result := BroadcastResult{Recipients: []common.Address{}}
+	if len(recipients) == 0 {
+		return result, nil
+	}
+
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return result, fmt.Errorf("error marshaling broadcast: %v", err)
+	}
+
+	for _, delivery := range h.smCallManager.ForwardEventToParticipants(roomID, recipients, payloadBytes) {
+		if delivery.Error != nil {
+			log.Printf("Error delivering broadcast in room %s to %s: %v", roomID, delivery.Participant.Hex(), delivery.Error)
+			result.Failed = append(result.Failed, delivery.Participant)
+			continue
+		}
+		result.Recipients = append(result.Recipients, delivery.Participant)
+	}
+	return result, nil
+}
+
+// broadcastRecipients returns the participants that are not excluded
+func broadcastRecipients(participants []contract.DAppMeetingParticipantDetails, exclude []common.Address) []common.Address {
+	excluded := make(map[common.Address]bool, len(exclude))
+	for _, address := range exclude {
+		excluded[address] = true
+	}
+
+	var recipients []common.Address
+	for _, participant := range participants {
+		if !excluded[participant.WalletAddress] {
+			recipients = append(recipients, participant.WalletAddress)
+		}
+	}
+	return recipients
 }
 
-// HandleTrackAdded processes TrackAdded events
-func (h *EventHandler) HandleTrackAdded(event *contract.ContractTrackAdded) {
+// roomParticipants returns the participants of a room with their tracks, from the projection when it knows the room
+func (h *EventHandler) roomParticipants(roomID string) ([]contract.DAppMeetingParticipantDetails, error) {
+	if h.projection != nil {
+		if state, ok := h.projection.Room(roomID); ok {
+			details := make([]contract.DAppMeetingParticipantDetails, len(state.Participants))
+			for i, participant := range state.Participants {
+				details[i] = contract.DAppMeetingParticipantDetails{
+					WalletAddress: participant.Address,
+					Name:          participant.Name,
+					SessionID:     participant.SessionID,
+					Tracks:        participant.Tracks,
+				}
+			}
+			return details, nil
+		}
+	}
+
+	opts := &bind.CallOpts{Context: context.Background()}
+	return h.contractInstance.GetRoomParticipantsDetails(opts, roomID)
+}
+
+// HandleTrackAdded processes TrackAdded events by notifying webhook subscribers. Tracks are not announced
+// from here: any participant can emit TrackAdded with any name and session, and the event carries no mid.
+// The requests that published the tracks announce them instead, join-room for the initial tracks and
+// publish-track or publish-datachannel for the others, once the backend recorded them itself.
+func (h *EventHandler) HandleTrackAdded(event *contract.ContractTrackAdded) error {
 	log.Printf("Track Added - Room: %s, Participant: %s, Track Name: %s",
 		event.RoomId, event.Participant.Hex(), event.TrackName)
 
-	// Additional logic can be added here if needed for track handling
+	h.publishWebhook(NewWebhookEvent(WebhookTrackPublished, event.RoomId, event.Participant, event.Raw,
+		map[string]interface{}{"trackName": event.TrackName, "sessionId": event.SessionId}))
+	return nil
 }
 
 // HandleEventToBackend processes EventForwardedToBackend events
-func (h *EventHandler) HandleEventToBackend(event *contract.ContractEventForwardedToBackend) {
-	log.Printf("Event To Backend - Room: %s, Sender: %s",
-		event.RoomId, event.Sender.Hex())
+func (h *EventHandler) HandleEventToBackend(event *contract.ContractEventForwardedToBackend) error {
+	return h.handleEventToBackend(event, false)
+}
 
-	// Parse the event data to determine action
-	var eventData map[string]interface{}
-	if err := json.Unmarshal(event.EventData, &eventData); err != nil {
-		log.Printf("Error parsing event data: %v", err)
-		return
+// handleEventToBackend processes an EventForwardedToBackend event, or retries one from the dead letters
+func (h *EventHandler) handleEventToBackend(event *contract.ContractEventForwardedToBackend, retry bool) error {
+	ctx := &MessageContext{
+		Context:   context.Background(),
+		RoomID:    event.RoomId,
+		Sender:    event.Sender,
+		RequestID: logRequestID(event.Raw),
+		Raw:       event.Raw,
+		handler:   h,
+		retry:     retry,
 	}
 
-	// Check event type and handle accordingly
-	if eventType, ok := eventData["type"].(string); ok {
-		switch eventType {
-		case "publish-track":
-			h.handlePublishTrack(event.RoomId, event.Sender, eventData)
-		case "pull-track":
-			h.handlePullTrack(event.RoomId, event.Sender, eventData)
-		case "close-track":
-			h.handleCloseTrack(event.RoomId, event.Sender, eventData)
-		case "renegotiation":
-			h.handleRenegotiation(event.RoomId, event.Sender, eventData)
-		default:
-			log.Printf("Unknown event type: %s", eventType)
+	// Parse the event data to determine action
+	eventData, err := decodeEventData(event.EventData)
+	if err == nil {
+		ctx.Type, _ = eventData["type"].(string)
+		ctx.Payload = eventData
+		if requestID, ok := eventData["requestId"].(string); ok && requestID != "" {
+			ctx.RequestID = requestID
 		}
 	}
-}
-
-// Helper methods for specific event types
-// handlePublishTrack processes publish track events from smart contract
-func (h *EventHandler) handlePublishTrack(roomID string, sender common.Address, eventData map[string]interface{}) {
-	log.Printf("Handling publish track event for room %s and participant %s", roomID, sender.Hex())
 
-	// Check if a sessionID was already provided
-	var sessionID string
-	var err error
+	if frontendNotifications[ctx.Type] {
+		ctx.Logf("Ignoring %s notification from %s", ctx.Type, event.Sender.Hex())
+		return nil
+	}
 
-	// Create a new session
-	sessionID, err = h.cloudflareService.CreateSession()
+	// Unreadable requests count against the limits as well, they cost an error reply
+	if limitErr := h.checkRateLimit(ctx, responseTypeFor(ctx.Type)); limitErr != nil {
+		return limitErr
+	}
 	if err != nil {
-		log.Printf("Error creating session: %v", err)
-		return
+		return h.replyError(ctx, responseTypeFor(""),
+			NewMessageError(ErrCodeInvalidRequest, "error parsing event data: %v", err))
 	}
-	log.Printf("Created new session ID: %s", sessionID)
+	ctx.Logf("Event To Backend - Room: %s, Sender: %s, Type: %s",
+		event.RoomId, event.Sender.Hex(), ctx.Type)
 
-	// Extract compressed data if available
-	var compressedData string
-	if cd, ok := eventData["compressedData"].(string); ok {
-		compressedData = cd
+	// Dispatch to the registered handler and answer every failure with an error response
+	if err := h.registry.Dispatch(ctx); err != nil {
+		return h.failRequest(ctx, EventNameForwardedToBackend, h.replyError(ctx, responseTypeFor(ctx.Type), err))
 	}
+	h.completeRequest(ctx)
+	return nil
+}
 
-	var offer map[string]interface{}
-	var tracks []map[string]interface{}
+// checkRateLimit applies the rate limiter to a new request. Throttled requests are answered
+// with a rate_limited error; requests of senders blocked for abuse are dropped without a reply.
+func (h *EventHandler) checkRateLimit(ctx *MessageContext, responseType string) error {
+	if h.rateLimiter == nil || ctx.retry {
+		return nil
+	}
 
-	// If we have compressed data, decompress and parse it
-	if compressedData != "" {
-		decompressed, err := h.cloudflareService.decompressData([]byte(compressedData))
-		if err != nil {
-			log.Printf("Error decompressing track data: %v", err)
-			return
-		}
+	switch h.rateLimiter.Allow(ctx.RoomID, ctx.Sender) {
+	case RateThrottled:
+		return h.replyError(ctx, responseType,
+			NewMessageError(ErrCodeRateLimited, "rate limit exceeded for %s, retry later", ctx.Type))
+	case RateDropped:
+		ctx.Logf("Dropping %s request from blocked sender %s without reply", ctx.Type, ctx.Sender.Hex())
+		return NewMessageError(ErrCodeRateLimited, "sender %s is blocked for abuse, request dropped", ctx.Sender.Hex())
+	}
+	return nil
+}
 
-		log.Printf("Decompressed track data: %s", decompressed)
+// chargeFanOut charges a request that sends one transaction per recipient to the rate limiter.
+// The request itself already paid for one of them, and gets its token back when refused.
+func (h *EventHandler) chargeFanOut(ctx *MessageContext, recipients int) error {
+	if h.rateLimiter == nil || ctx.retry || recipients <= 1 {
+		return nil
+	}
+	if !h.rateLimiter.Charge(ctx.RoomID, ctx.Sender, recipients-1) {
+		h.rateLimiter.Refund(ctx.RoomID, ctx.Sender)
+		return NewMessageError(ErrCodeRateLimited, "rate limit exceeded for %s to %d participants, retry later", ctx.Type, recipients)
+	}
+	return nil
+}
 
-		// Parse decompressed data
-		var trackData struct {
-			Offer  map[string]interface{}   `json:"offer"`
-			Tracks []map[string]interface{} `json:"tracks"`
+// failRequest keeps a server-side failure as a dead letter and returns it. The step checkpoints
+// of failures that are not kept are cleared.
+func (h *EventHandler) failRequest(ctx *MessageContext, eventName string, err error) error {
+	messageErr := asMessageError(err)
+	if h.deadLetters == nil {
+		return messageErr
+	}
+	if deadLetterCodes[messageErr.Code] {
+		storeErr := h.deadLetters.Add(ctx, eventName, messageErr)
+		if storeErr == nil {
+			ctx.Logf("Stored %s as dead letter after failing at step %q", eventName, ctx.failedStep)
+			return messageErr
 		}
+		ctx.Logf("Error storing dead letter: %v", storeErr)
+	}
 
-		if err := json.Unmarshal([]byte(decompressed), &trackData); err != nil {
-			log.Printf("Error parsing decompressed track data: %v", err)
-			return
-		}
+	// Without a dead letter the request is never retried, its step checkpoints are of no use.
+	// A retried dead letter stays pending, so its checkpoints are kept.
+	if !ctx.retry {
+		h.completeRequest(ctx)
+	}
+	return messageErr
+}
 
-		offer = trackData.Offer
-		tracks = trackData.Tracks
-	} else {
-		// Try to extract offer and tracks directly from event data
-		if o, ok := eventData["offer"].(map[string]interface{}); ok {
-			offer = o
-		} else {
-			log.Printf("Missing or invalid offer in publish-track event")
-			return
-		}
+// completeRequest forgets the step checkpoints of a request that was fully handled
+func (h *EventHandler) completeRequest(ctx *MessageContext) {
+	if h.deadLetters == nil {
+		return
+	}
+	if err := h.deadLetters.ClearSteps(logRequestID(ctx.Raw)); err != nil {
+		ctx.Logf("Error clearing step checkpoints: %v", err)
+	}
+}
 
-		if t, ok := eventData["tracks"].([]interface{}); ok {
-			// Convert tracks to the required format
-			tracks = make([]map[string]interface{}, len(t))
-			for i, track := range t {
-				if trackMap, ok := track.(map[string]interface{}); ok {
-					tracks[i] = map[string]interface{}{
-						"trackName": trackMap["trackName"],
-						"mid":       trackMap["mid"],
-						"location":  trackMap["location"],
-					}
-				} else {
-					log.Printf("Invalid track format at index %d", i)
-				}
+// RetryDeadLetters handles the dead letters an operator asked to retry, reusing the steps
+// that already completed. Letters that fail again go back to pending.
+func (h *EventHandler) RetryDeadLetters() {
+	if h.deadLetters == nil {
+		return
+	}
+	letters, err := h.deadLetters.RetryRequested()
+	if err != nil {
+		log.Printf("Error listing dead letters to retry: %v", err)
+		return
+	}
+
+	for _, letter := range letters {
+		log.Printf("Retrying dead letter %d (%s %s, failed at %q)", letter.ID, letter.EventName, letter.RequestID, letter.FailedStep)
+		if err := h.retryDeadLetter(letter); err != nil {
+			log.Printf("Retry of dead letter %d failed: %v", letter.ID, err)
+			if err := h.deadLetters.Release(letter.ID); err != nil {
+				log.Printf("Error returning dead letter %d to pending: %v", letter.ID, err)
 			}
-		} else {
-			log.Printf("Missing or invalid tracks in publish-track event")
-			return
+			continue
+		}
+		if err := h.deadLetters.Resolve(letter.ID); err != nil {
+			log.Printf("Error resolving dead letter %d: %v", letter.ID, err)
 		}
 	}
+}
 
-	// Ensure tracks are properly formatted for Cloudflare API
-	formattedTracks := make([]map[string]interface{}, len(tracks))
-	for i, track := range tracks {
-		formattedTracks[i] = map[string]interface{}{
-			"trackName": track["trackName"],
-			"mid":       track["mid"],
-			"location":  track["location"],
+// retryDeadLetter decodes the stored log and handles the event again
+func (h *EventHandler) retryDeadLetter(letter DeadLetter) error {
+	raw, err := letter.RawEvent()
+	if err != nil {
+		return err
+	}
+
+	switch letter.EventName {
+	case EventNameParticipantJoined:
+		event, err := h.contractInstance.ParseParticipantJoined(raw)
+		if err != nil {
+			return fmt.Errorf("error parsing %s log: %v", letter.EventName, err)
 		}
+		return h.handleParticipantJoined(event, true)
+	case EventNameForwardedToBackend:
+		event, err := h.contractInstance.ParseEventForwardedToBackend(raw)
+		if err != nil {
+			return fmt.Errorf("error parsing %s log: %v", letter.EventName, err)
+		}
+		return h.handleEventToBackend(event, true)
+	default:
+		return fmt.Errorf("cannot retry %s events", letter.EventName)
 	}
+}
 
-	log.Printf("Calling Cloudflare to publish tracks with sessionID: %s", sessionID)
-	log.Printf("Tracks to publish: %+v", formattedTracks)
+// replyError answers a failed request with the error envelope and returns the failure
+func (h *EventHandler) replyError(ctx *MessageContext, responseType string, err error) error {
+	messageErr := asMessageError(err)
+	response := newErrorResponse(responseType, ctx.Type, ctx.RequestID, messageErr)
+	if messageErr.Code == ErrCodeUnsupportedType {
+		response.SupportedTypes = h.registry.Types()
+	}
 
-	// Call Cloudflare to publish tracks
-	response, err := h.cloudflareService.PublishTracks(sessionID, offer, formattedTracks)
+	if _, sendErr := h.forwardToFrontend(ctx.RoomID, ctx.Sender, response, false); sendErr != nil {
+		ctx.Logf("Error sending %s error response to %s: %v", responseType, ctx.Sender.Hex(), sendErr)
+	}
+	return messageErr
+}
+
+// forwardToFrontend marshals a response, optionally zlib compresses it, and forwards it to a participant
+func (h *EventHandler) forwardToFrontend(roomID string, participant common.Address, response interface{}, compress bool) (common.Hash, error) {
+	responseBytes, err := json.Marshal(response)
 	if err != nil {
-		log.Printf("Error publishing tracks: %v", err)
-		return
+		return common.Hash{}, fmt.Errorf("error marshaling response: %v", err)
 	}
 
-	// Send response back to frontend
-	responseData := map[string]interface{}{
-		"type": "publish-track-response",
-		"cloudflareResponse": map[string]interface{}{
-			"sessionDescription": response["sessionDescription"],
-			"tracks":             response["tracks"],
-			"txHash":             response["txHash"],
-		},
+	if compress {
+		var compressed bytes.Buffer
+		w := zlib.NewWriter(&compressed)
+		w.Write(responseBytes)
+		w.Close()
+		responseBytes = compressed.Bytes()
 	}
 
-	responseBytes, err := json.Marshal(responseData)
+	return h.smCallManager.ForwardEventToFrontend(roomID, participant, responseBytes)
+}
+
+// Helper methods for specific event types
+// handlePublishTrack processes publish track events from smart contract
+func (h *EventHandler) handlePublishTrack(ctx *MessageContext, request PublishTrackRequest) error {
+	roomID, sender := ctx.RoomID, ctx.Sender
+	ctx.Logf("Handling publish track event for room %s and participant %s", roomID, sender.Hex())
+
+	// Create a new session
+	sessionID, err := RunStep(ctx, "create-session", h.cloudflareService.CreateSession)
 	if err != nil {
-		log.Printf("Error marshaling response: %v", err)
-		return
+		return NewMessageError(ErrCodeSessionFailed, "error creating session: %v", err)
+	}
+	ctx.Logf("Created new session ID: %s", sessionID)
+	h.recordSession(ctx, sessionID)
+
+	// Format tracks for the Cloudflare API
+	formattedTracks := make([]map[string]interface{}, len(request.Tracks))
+	for i, track := range request.Tracks {
+		formattedTracks[i] = map[string]interface{}{
+			"trackName": track.TrackName,
+			"mid":       track.Mid,
+			"location":  track.Location,
+		}
+	}
+
+	ctx.Logf("Calling Cloudflare to publish tracks with sessionID: %s", sessionID)
+	ctx.Logf("Tracks to publish: %+v", formattedTracks)
+
+	// Call Cloudflare to publish tracks
+	response, err := RunStep(ctx, "publish-tracks", func() (map[string]interface{}, error) {
+		return h.cloudflareService.PublishTracks(sessionID, request.Offer.toMap(), formattedTracks)
+	})
+	if err != nil {
+		return NewMessageError(ErrCodeCloudflare, "error publishing tracks: %v", err)
 	}
 
 	// Forward the response to the frontend
-	txHash, err := h.smCallManager.ForwardEventToFrontend(roomID, sender, responseBytes)
+	txHash, err := RunStep(ctx, "forward-response", func() (common.Hash, error) {
+		return h.forwardToFrontend(roomID, sender, PublishTrackResponse{
+			MessageHeader:    responseHeader("publish-track-response", ctx.RequestID),
+			ResponseEnvelope: successEnvelope("publish-track"),
+			CloudflareResponse: PublishTrackResult{
+				SessionDescription: response["sessionDescription"],
+				Tracks:             response["tracks"],
+				TxHash:             response["txHash"],
+			},
+		}, false)
+	})
 	if err != nil {
-		log.Printf("Error forwarding response to frontend: %v", err)
-		return
+		return NewMessageError(ErrCodeContract, "error forwarding response to frontend: %v", err)
 	}
 
 	// Log the successful response with the actual transaction hash
-	log.Printf("Successfully handled publish-track event for %s, txHash: %s", sender.Hex(), txHash)
+	ctx.Logf("Successfully handled publish-track event for %s, txHash: %s", sender.Hex(), txHash)
 
 	// Update session ID in the smart contract
-	_, err = h.smCallManager.SetParticipantSessionID(roomID, sender, sessionID)
+	_, err = RunStep(ctx, "set-session-id", func() (common.Hash, error) {
+		return h.smCallManager.SetParticipantSessionID(roomID, sender, sessionID)
+	})
 	if err != nil {
-		log.Printf("Error updating session ID in contract: %v", err)
+		ctx.Logf("Error updating session ID in contract: %v", err)
 		// Continue anyway as we need to send response back to frontend
 	}
 
 	// Process Cloudflare response and update smart contract with the track information
+	h.addPublishedTracks(ctx, sessionID, response, request.Tracks)
+	return nil
+}
+
+// addPublishedTracks records the tracks of a Cloudflare publish response on the contract
+// and announces them to the rest of the room with the simulcast layers of the published descriptors
+func (h *EventHandler) addPublishedTracks(ctx *MessageContext, sessionID string, response map[string]interface{}, published []TrackDescriptor) {
+	roomID, sender := ctx.RoomID, ctx.Sender
+	rids := make(map[string][]string, len(published))
+	for _, track := range published {
+		if len(track.Encodings) > 0 {
+			rids[track.TrackName] = track.rids()
+		}
+	}
+	var announced []AvailableTrack
 	if cloudflareTracks, ok := response["tracks"].([]interface{}); ok && len(cloudflareTracks) > 0 {
-		log.Printf("Received Cloudflare tracks: %+v", cloudflareTracks)
+		ctx.Logf("Received Cloudflare tracks: %+v", cloudflareTracks)
 
 		// For each track returned from Cloudflare, update the smart contract
 		for _, cfTrack := range cloudflareTracks {
@@ -285,317 +780,410 @@ func (h *EventHandler) handlePublishTrack(roomID string, sender common.Address,
 
 				if mid != "" && trackName != "" {
 					// Call the smart contract function to add the track
-					log.Printf("Adding track to smart contract - Room: %s, Participant: %s, TrackName: %s, Mid: %s",
+					ctx.Logf("Adding track to smart contract - Room: %s, Participant: %s, TrackName: %s, Mid: %s",
 						roomID, sender.Hex(), trackName, mid)
 
 					// Use the addNewTrackAfterPublish function to update track info on the contract
 					location := "local" // Default location value
 					isPublished := true // Default isPublished value
 
-					txHash, err := h.smCallManager.AddNewTrackAfterPublish(
-						roomID,
-						sender,
-						sessionID,
-						trackName,
-						mid,
-						location,
-						isPublished,
-					)
+					txHash, err := RunStep(ctx, "add-track:"+trackName, func() (common.Hash, error) {
+						return h.smCallManager.AddNewTrackAfterPublish(
+							roomID,
+							sender,
+							sessionID,
+							trackName,
+							mid,
+							location,
+							isPublished,
+						)
+					})
 
 					if err != nil {
-						log.Printf("Error adding track to smart contract: %v", err)
+						ctx.Logf("Error adding track to smart contract: %v", err)
 					} else {
-						log.Printf("Successfully added track to smart contract, txHash: %s", txHash)
+						ctx.Logf("Successfully added track to smart contract, txHash: %s", txHash)
+						h.recordTrack(ctx, sessionID, trackName, mid, location)
+						announced = append(announced, AvailableTrack{TrackName: trackName, Mid: mid, Location: location, Rids: rids[trackName]})
 					}
 				}
 			}
 		}
 	}
+	h.announceTracks(ctx, sender, sessionID, announced)
 }
 
-// handlePullTrack processes pull track events from smart contract
-func (h *EventHandler) handlePullTrack(roomID string, sender common.Address, eventData map[string]interface{}) {
-	log.Printf("[Smart Contract Event] Received track pull event for room %s from %s",
+// handlePullTrack processes pull track events from smart contract. Every requested track is checked
+// against the contract, and the tracks found are pulled in a single Cloudflare call.
+func (h *EventHandler) handlePullTrack(ctx *MessageContext, request PullTrackRequest) error {
+	roomID, sender, sessionID := ctx.RoomID, ctx.Sender, request.SessionID
+	ctx.Logf("[Smart Contract Event] Received track pull event for room %s from %s",
 		roomID, sender.Hex())
 
-	// Extract session ID, remote session ID and track name from eventData
-	var sessionID, remoteSessionID, trackName string
-	if compressedData, ok := eventData["compressedData"].(string); ok && compressedData != "" {
-		// Decompress data
-		decompressed, err := h.cloudflareService.decompressData([]byte(compressedData))
-		if err != nil {
-			log.Printf("[Error] Failed to decompress pull track data: %v", err)
-			return
-		}
+	ctx.Logf("[Pull Request] Session %s requesting to pull %d tracks", sessionID, len(request.Tracks))
 
-		// Parse decompressed data
-		var pullData struct {
-			SessionId       string `json:"sessionId"`
-			RemoteSessionId string `json:"remoteSessionId"`
-			TrackName       string `json:"trackName"`
-		}
-		if err := json.Unmarshal([]byte(decompressed), &pullData); err != nil {
-			log.Printf("[Error] Failed to parse pull data: %v", err)
-			return
-		}
+	// Only pull into the sender's own session
+	if err := h.verifySession(ctx, sessionID); err != nil {
+		return err
+	}
 
-		sessionID = pullData.SessionId
-		remoteSessionID = pullData.RemoteSessionId
-		trackName = pullData.TrackName
-	} else {
-		// Extract data directly from eventData
-		if sid, ok := eventData["sessionId"].(string); !ok {
-			log.Printf("[Error] Missing sessionId in pull track event")
-			return
-		} else {
-			sessionID = sid
-		}
-		if rsid, ok := eventData["remoteSessionId"].(string); !ok {
-			log.Printf("[Error] Missing remoteSessionId in pull track event")
-			return
-		} else {
-			remoteSessionID = rsid
-		}
-		if tn, ok := eventData["trackName"].(string); !ok {
-			log.Printf("[Error] Missing trackName in pull track event")
-			return
-		} else {
-			trackName = tn
+	// Only pull media tracks published in the room
+	participants, err := h.roomParticipants(roomID)
+	if err != nil {
+		return NewMessageError(ErrCodeContract, "error reading tracks of room %s: %v", roomID, err)
+	}
+	published := make(map[RemoteTrack]bool)
+	for _, participant := range participants {
+		for _, track := range participant.Tracks {
+			if track.Location != DataChannelLocation {
+				published[RemoteTrack{RemoteSessionID: track.SessionId, TrackName: track.TrackName}] = true
+			}
 		}
 	}
 
-	log.Printf("[Pull Request] Session %s requesting to pull track %s from session %s",
-		sessionID, trackName, remoteSessionID)
+	statuses := make([]PullTrackStatus, len(request.Tracks))
+	var tracks []map[string]interface{}
+	var pulled []int
+	for i, track := range request.Tracks {
+		statuses[i] = PullTrackStatus{RemoteSessionID: track.RemoteSessionID, TrackName: track.TrackName}
+		if !published[RemoteTrack{RemoteSessionID: track.RemoteSessionID, TrackName: track.TrackName}] {
+			statuses[i].Status = PullStatusNotFound
+			statuses[i].Error = "track is not published in the room"
+			continue
+		}
 
-	// Prepare pull request for Cloudflare
-	tracks := []map[string]interface{}{
-		{
-			"trackName": trackName,
+		// Prepare pull request for Cloudflare
+		cfTrack := map[string]interface{}{
+			"trackName": track.TrackName,
 			"location":  "remote",
-			"sessionId": remoteSessionID,
-		},
+			"sessionId": track.RemoteSessionID,
+		}
+		if track.PreferredRid != "" {
+			cfTrack["simulcast"] = map[string]interface{}{"preferredRid": track.PreferredRid}
+		}
+		tracks = append(tracks, cfTrack)
+		pulled = append(pulled, i)
+	}
+	if len(tracks) == 0 {
+		return NewMessageError(ErrCodeInvalidRequest, "none of the %d tracks is published in room %s", len(request.Tracks), roomID)
 	}
 
 	// Call Cloudflare service to pull tracks
-	response, err := h.cloudflareService.PullTracks(sessionID, tracks)
+	response, err := RunStep(ctx, "pull-tracks", func() (map[string]interface{}, error) {
+		return h.cloudflareService.PullTracks(sessionID, tracks)
+	})
 	if err != nil {
-		log.Printf("[Error] Failed to pull tracks: %v", err)
-		errorResponse := map[string]interface{}{
-			"type":             "pull-track-response",
-			"errorCode":        500,
-			"errorDescription": fmt.Sprintf("Failed to pull track: %v", err),
-		}
-
-		responseBytes, _ := json.Marshal(errorResponse)
-		// Compress error response
-		var compressed bytes.Buffer
-		w := zlib.NewWriter(&compressed)
-		w.Write(responseBytes)
-		w.Close()
+		return NewMessageError(ErrCodeCloudflare, "failed to pull tracks: %v", err)
+	}
 
-		// Send error response back to frontend
-		_, err = h.smCallManager.ForwardEventToFrontend(roomID, sender, compressed.Bytes())
-		if err != nil {
-			log.Printf("[Error] Failed to send error response: %v", err)
+	// Cloudflare reports the tracks in request order, with an error code on the ones it could not pull
+	cfTracks, _ := response["tracks"].([]interface{})
+	for j, i := range pulled {
+		statuses[i].Status = PullStatusPulled
+		if j >= len(cfTracks) {
+			continue
+		}
+		cfTrack, _ := cfTracks[j].(map[string]interface{})
+		if mid, ok := cfTrack["mid"].(string); ok {
+			statuses[i].Mid = mid
+		}
+		if errorCode, ok := cfTrack["errorCode"].(string); ok && errorCode != "" {
+			statuses[i].Status = PullStatusFailed
+			statuses[i].Error, _ = cfTrack["errorDescription"].(string)
+			if statuses[i].Error == "" {
+				statuses[i].Error = errorCode
+			}
 		}
-		return
 	}
 
 	// Check if response contains session description for renegotiation
-	responseData := map[string]interface{}{
-		"type":                           "pull-track-response",
-		"sessionId":                      sessionID,
-		"requiresImmediateRenegotiation": false,
+	responseData := PullTrackResponse{
+		MessageHeader:    responseHeader("pull-track-response", ctx.RequestID),
+		ResponseEnvelope: successEnvelope("pull-track"),
+		SessionID:        sessionID,
+		Tracks:           statuses,
 	}
-
 	if sdp, ok := response["sessionDescription"].(map[string]interface{}); ok {
-		responseData["requiresImmediateRenegotiation"] = true
-		responseData["sessionDescription"] = sdp
+		responseData.RequiresImmediateRenegotiation = true
+		responseData.SessionDescription = sdp
 	}
 
-	// Send success response back to frontend
-	responseBytes, err := json.Marshal(responseData)
-	if err != nil {
-		log.Printf("[Error] Failed to marshal response: %v", err)
-		return
+	// Send compressed response to frontend
+	if _, err := RunStep(ctx, "forward-response", func() (common.Hash, error) {
+		return h.forwardToFrontend(roomID, sender, responseData, true)
+	}); err != nil {
+		return NewMessageError(ErrCodeContract, "failed to send success response: %v", err)
 	}
 
-	// Compress response
-	var compressed bytes.Buffer
-	w := zlib.NewWriter(&compressed)
-	w.Write(responseBytes)
-	w.Close()
-
-	// Send response to frontend
-	_, err = h.smCallManager.ForwardEventToFrontend(roomID, sender, compressed.Bytes())
-	if err != nil {
-		log.Printf("[Error] Failed to send success response: %v", err)
-		return
+	pulledCount := 0
+	for _, status := range statuses {
+		if status.Status == PullStatusPulled {
+			pulledCount++
+		}
 	}
-
-	log.Printf("[Success] Successfully pulled track %s from session %s for session %s",
-		trackName, remoteSessionID, sessionID)
+	ctx.Logf("[Success] Pulled %d of %d tracks for session %s", pulledCount, len(request.Tracks), sessionID)
+	return nil
 }
 
 // handleCloseTrack processes close track events from smart contract
-func (h *EventHandler) handleCloseTrack(roomID string, sender common.Address, eventData map[string]interface{}) {
-	// Implementation for closing tracks
-	sessionID, ok := eventData["sessionID"].(string)
-	if !ok {
-		log.Printf("Missing sessionID in close-track event")
-		return
+func (h *EventHandler) handleCloseTrack(ctx *MessageContext, request CloseTrackRequest) error {
+	if err := h.verifySession(ctx, request.SessionID); err != nil {
+		return err
 	}
 
-	trackData, ok := eventData["tracks"].([]interface{})
-	if !ok {
-		log.Printf("Missing or invalid tracks in close-track event")
-		return
+	tracks := make([]map[string]string, len(request.Tracks))
+	for i, track := range request.Tracks {
+		tracks[i] = map[string]string{"mid": track.Mid}
 	}
 
-	// Convert tracks to the required format
-	tracks := make([]map[string]string, len(trackData))
-	for i, t := range trackData {
-		if trackMap, ok := t.(map[string]interface{}); ok {
-			stringMap := make(map[string]string)
-			for k, v := range trackMap {
-				if strVal, ok := v.(string); ok {
-					stringMap[k] = strVal
-				}
-			}
-			tracks[i] = stringMap
-		}
+	// Call Cloudflare to close tracks
+	response, err := RunStep(ctx, "close-tracks", func() (map[string]interface{}, error) {
+		return h.cloudflareService.CloseTracks(request.SessionID, tracks, request.Force, request.SessionDescription.toMap())
+	})
+	if err != nil {
+		return NewMessageError(ErrCodeCloudflare, "error closing tracks: %v", err)
 	}
 
-	force := false
-	if forceVal, ok := eventData["force"].(bool); ok {
-		force = forceVal
+	// Forward the response to the frontend via our queue
+	_, err = RunStep(ctx, "forward-response", func() (common.Hash, error) {
+		return h.forwardToFrontend(ctx.RoomID, ctx.Sender, CloseTrackResponse{
+			MessageHeader:      responseHeader("close-track-response", ctx.RequestID),
+			ResponseEnvelope:   successEnvelope("close-track"),
+			CloudflareResponse: response,
+		}, false)
+	})
+	if err != nil {
+		return NewMessageError(ErrCodeContract, "error forwarding response to frontend: %v", err)
 	}
+	return nil
+}
 
-	var sessionDescription map[string]interface{}
-	if sd, ok := eventData["sessionDescription"].(map[string]interface{}); ok {
-		sessionDescription = sd
+// handleRenegotiation processes renegotiation requests
+func (h *EventHandler) handleRenegotiation(ctx *MessageContext, request RenegotiationRequest) error {
+	roomID, sender := ctx.RoomID, ctx.Sender
+	ctx.Logf("Handling renegotiation for room %s from participant %s", roomID, sender.Hex())
+
+	if err := h.verifySession(ctx, request.SessionID); err != nil {
+		return err
 	}
 
-	// Call Cloudflare to close tracks
-	response, err := h.cloudflareService.CloseTracks(sessionID, tracks, force, sessionDescription)
+	// Call Cloudflare to renegotiate
+	response, err := RunStep(ctx, "renegotiate", func() (map[string]interface{}, error) {
+		return h.cloudflareService.Renegotiate(request.SessionID, request.SessionDescription.toMap())
+	})
 	if err != nil {
-		log.Printf("Error closing tracks: %v", err)
-		return
+		return NewMessageError(ErrCodeCloudflare, "failed to renegotiate: %v", err)
 	}
 
-	// Send response back to frontend
-	responseData := map[string]interface{}{
-		"type":               "close-track-response",
-		"cloudflareResponse": response,
+	// Forward the response to the frontend
+	_, err = RunStep(ctx, "forward-response", func() (common.Hash, error) {
+		return h.forwardToFrontend(roomID, sender, RenegotiationResponse{
+			MessageHeader:      responseHeader("renegotiation-response", ctx.RequestID),
+			ResponseEnvelope:   successEnvelope("renegotiation"),
+			SessionID:          request.SessionID,
+			SessionDescription: response["sessionDescription"],
+		}, false)
+	})
+	if err != nil {
+		return NewMessageError(ErrCodeContract, "error forwarding response to frontend: %v", err)
 	}
+	return nil
+}
+
+// handleSetLayer switches the simulcast layer the sender receives for a pulled track
+func (h *EventHandler) handleSetLayer(ctx *MessageContext, request SetLayerRequest) error {
+	ctx.Logf("Switching track %s of session %s to layer %s for session %s",
+		request.TrackName, request.RemoteSessionID, request.Rid, request.SessionID)
 
-	responseBytes, err := json.Marshal(responseData)
+	if err := h.verifySession(ctx, request.SessionID); err != nil {
+		return err
+	}
+	if h.sessions != nil {
+		if err := h.sessions.VerifyRoom(ctx.RoomID, request.RemoteSessionID); err != nil {
+			return err
+		}
+	}
+
+	tracks := []map[string]interface{}{
+		{
+			"location":  "remote",
+			"trackName": request.TrackName,
+			"sessionId": request.RemoteSessionID,
+			"mid":       request.Mid,
+			"simulcast": map[string]interface{}{"preferredRid": request.Rid},
+		},
+	}
+	response, err := RunStep(ctx, "update-tracks", func() (map[string]interface{}, error) {
+		return h.cloudflareService.UpdateTracks(request.SessionID, tracks)
+	})
 	if err != nil {
-		log.Printf("Error marshaling response: %v", err)
-		return
+		return NewMessageError(ErrCodeCloudflare, "failed to set layer: %v", err)
 	}
 
-	// Forward the response to the frontend via our queue
-	_, err = h.smCallManager.ForwardEventToFrontend(roomID, sender, responseBytes)
+	responseData := SetLayerResponse{
+		MessageHeader:    responseHeader("set-layer-response", ctx.RequestID),
+		ResponseEnvelope: successEnvelope("set-layer"),
+		SessionID:        request.SessionID,
+		Mid:              request.Mid,
+		Rid:              request.Rid,
+	}
+	if sdp, ok := response["sessionDescription"].(map[string]interface{}); ok {
+		responseData.RequiresImmediateRenegotiation = true
+		responseData.SessionDescription = sdp
+	}
+
+	_, err = RunStep(ctx, "forward-response", func() (common.Hash, error) {
+		return h.forwardToFrontend(ctx.RoomID, ctx.Sender, responseData, false)
+	})
 	if err != nil {
-		log.Printf("Error forwarding response to frontend: %v", err)
+		return NewMessageError(ErrCodeContract, "error forwarding response to frontend: %v", err)
 	}
+	return nil
 }
 
-// handleRenegotiation processes renegotiation requests
-func (h *EventHandler) handleRenegotiation(roomID string, sender common.Address, eventData map[string]interface{}) {
-	log.Printf("Handling renegotiation for room %s from participant %s", roomID, sender.Hex())
+// handleBroadcast delivers a room-wide notice from the sender to the other participants
+func (h *EventHandler) handleBroadcast(ctx *MessageContext, request BroadcastRequest) error {
+	exclude := make([]common.Address, 0, len(request.Exclude)+1)
+	for _, address := range request.Exclude {
+		exclude = append(exclude, common.HexToAddress(address))
+	}
+	if !request.IncludeSelf {
+		exclude = append(exclude, ctx.Sender)
+	}
+	ctx.Logf("Broadcasting %s in room %s from %s", request.Event, ctx.RoomID, ctx.Sender.Hex())
 
-	var sessionID string
-	var sessionDescription map[string]interface{}
+	participants, err := h.roomParticipants(ctx.RoomID)
+	if err != nil {
+		return NewMessageError(ErrCodeContract, "error reading participants of room %s: %v", ctx.RoomID, err)
+	}
+	if err := h.chargeFanOut(ctx, len(broadcastRecipients(participants, exclude))); err != nil {
+		return err
+	}
 
-	// Check for compressed data format first
-	if compressedData, ok := eventData["compressedData"].(string); ok && compressedData != "" {
-		// Decompress the data
-		decompressed, err := h.cloudflareService.decompressData([]byte(compressedData))
-		if err != nil {
-			log.Printf("Error decompressing renegotiation data: %v", err)
-			return
-		}
+	result, err := RunStep(ctx, "broadcast", func() (BroadcastResult, error) {
+		return h.broadcastTo(ctx.RoomID, participants, BroadcastNotification{
+			MessageHeader: responseHeader("broadcast", ctx.RequestID),
+			From:          ctx.Sender.Hex(),
+			Event:         request.Event,
+			Payload:       request.Payload,
+		}, exclude...)
+	})
+	if err != nil {
+		return NewMessageError(ErrCodeContract, "error broadcasting %s: %v", request.Event, err)
+	}
+	if len(result.Recipients) == 0 && len(result.Failed) > 0 {
+		return NewMessageError(ErrCodeContract, "broadcast %s could not be delivered to any participant", request.Event)
+	}
 
-		// Parse decompressed data
-		var renegotiationData struct {
-			SessionId          string                 `json:"sessionId"`
-			SessionDescription map[string]interface{} `json:"sessionDescription"`
-		}
+	response := BroadcastResponse{
+		MessageHeader:    responseHeader("broadcast-response", ctx.RequestID),
+		ResponseEnvelope: successEnvelope("broadcast"),
+		Recipients:       make([]string, len(result.Recipients)),
+	}
+	for i, recipient := range result.Recipients {
+		response.Recipients[i] = recipient.Hex()
+	}
+	for _, failed := range result.Failed {
+		response.Failed = append(response.Failed, failed.Hex())
+	}
 
-		if err := json.Unmarshal([]byte(decompressed), &renegotiationData); err != nil {
-			log.Printf("Error parsing decompressed renegotiation data: %v", err)
-			return
-		}
+	_, err = RunStep(ctx, "forward-response", func() (common.Hash, error) {
+		return h.forwardToFrontend(ctx.RoomID, ctx.Sender, response, false)
+	})
+	if err != nil {
+		return NewMessageError(ErrCodeContract, "error forwarding response to frontend: %v", err)
+	}
+	return nil
+}
 
-		sessionID = renegotiationData.SessionId
-		sessionDescription = renegotiationData.SessionDescription
-	} else {
-		// Extract data directly if not compressed
-		if sid, ok := eventData["sessionId"].(string); ok {
-			sessionID = sid
-		} else {
-			log.Printf("Missing sessionId in renegotiation event")
-			return
-		}
+// handleChatSend stores a chat message and relays it to the other participants
+func (h *EventHandler) handleChatSend(ctx *MessageContext, request ChatSendRequest) error {
+	if h.chat == nil {
+		return NewMessageError(ErrCodeUnsupportedType, "chat is not enabled on this backend")
+	}
 
-		if sd, ok := eventData["sessionDescription"].(map[string]interface{}); ok {
-			sessionDescription = sd
-		} else {
-			log.Printf("Missing or invalid sessionDescription in renegotiation event")
-			return
+	participants, err := h.roomParticipants(ctx.RoomID)
+	if err != nil {
+		return NewMessageError(ErrCodeContract, "error reading participants of room %s: %v", ctx.RoomID, err)
+	}
+	var senderName string
+	for _, participant := range participants {
+		if participant.WalletAddress == ctx.Sender {
+			senderName = participant.Name
 		}
 	}
 
-	// Call Cloudflare to renegotiate
-	response, err := h.cloudflareService.Renegotiate(sessionID, sessionDescription)
-	if err != nil {
-		log.Printf("Error during renegotiation: %v", err)
+	if err := h.chargeFanOut(ctx, len(broadcastRecipients(participants, []common.Address{ctx.Sender}))); err != nil {
+		return err
+	}
 
-		// Create error response
-		errorResponse := map[string]interface{}{
-			"type":             "renegotiation-response",
-			"errorCode":        500,
-			"errorDescription": fmt.Sprintf("Failed to renegotiate: %v", err),
-		}
+	chat, err := h.chat.Add(ctx.RoomID, ctx.Sender, senderName, request.Message, ctx.RequestID)
+	if err != nil {
+		return NewMessageError(ErrCodeInternal, "%v", err)
+	}
 
-		responseBytes, err := json.Marshal(errorResponse)
-		if err != nil {
-			log.Printf("Error marshaling error response: %v", err)
-			return
-		}
+	_, err = RunStep(ctx, "relay", func() (BroadcastResult, error) {
+		return h.broadcastTo(ctx.RoomID, participants, ChatMessageNotification{
+			MessageHeader: responseHeader("chat-message", ctx.RequestID),
+			Chat:          chat,
+		}, ctx.Sender)
+	})
+	if err != nil {
+		return NewMessageError(ErrCodeContract, "error relaying chat message: %v", err)
+	}
 
-		// Forward error response to the frontend
-		_, err = h.smCallManager.ForwardEventToFrontend(roomID, sender, responseBytes)
-		if err != nil {
-			log.Printf("Error forwarding error response to frontend: %v", err)
-		}
-		return
+	_, err = RunStep(ctx, "forward-response", func() (common.Hash, error) {
+		return h.forwardToFrontend(ctx.RoomID, ctx.Sender, ChatSendResponse{
+			MessageHeader:    responseHeader("chat-send-response", ctx.RequestID),
+			ResponseEnvelope: successEnvelope("chat-send"),
+			Chat:             chat,
+		}, false)
+	})
+	if err != nil {
+		return NewMessageError(ErrCodeContract, "error forwarding response to frontend: %v", err)
 	}
+	return nil
+}
 
-	// Send success response back to frontend
-	responseData := map[string]interface{}{
-		"type":               "renegotiation-response",
-		"sessionId":          sessionID,
-		"sessionDescription": response["sessionDescription"],
+// handleChatHistory answers with a page of the room's chat history
+func (h *EventHandler) handleChatHistory(ctx *MessageContext, request ChatHistoryRequest) error {
+	if h.chat == nil {
+		return NewMessageError(ErrCodeUnsupportedType, "chat is not enabled on this backend")
 	}
 
-	responseBytes, err := json.Marshal(responseData)
+	messages, hasMore, err := h.chat.History(ctx.RoomID, request.Before, request.Limit)
 	if err != nil {
-		log.Printf("Error marshaling response: %v", err)
-		return
+		return NewMessageError(ErrCodeInternal, "%v", err)
 	}
 
-	// Forward the response to the frontend
-	_, err = h.smCallManager.ForwardEventToFrontend(roomID, sender, responseBytes)
+	response := ChatHistoryResponse{
+		MessageHeader:    responseHeader("chat-history-response", ctx.RequestID),
+		ResponseEnvelope: successEnvelope("chat-history"),
+		Messages:         messages,
+		HasMore:          hasMore,
+	}
+	if hasMore && len(messages) > 0 {
+		response.NextBefore = messages[0].ID
+	}
+
+	// History pages can be long, compress them like pull responses
+	_, err = RunStep(ctx, "forward-response", func() (common.Hash, error) {
+		return h.forwardToFrontend(ctx.RoomID, ctx.Sender, response, true)
+	})
 	if err != nil {
-		log.Printf("Error forwarding response to frontend: %v", err)
+		return NewMessageError(ErrCodeContract, "error forwarding response to frontend: %v", err)
 	}
+	return nil
 }
 
-// GetParticipantTracks retrieves all tracks for a participant
+// GetParticipantTracks retrieves all tracks for a participant, from the projection when available
 func (h *EventHandler) GetParticipantTracks(roomID string, participant common.Address) ([]contract.DAppMeetingTrack, error) {
+	if h.projection != nil {
+		if state, ok := h.projection.Participant(roomID, participant); ok {
+			return state.Tracks, nil
+		}
+	}
+
 	opts := &bind.CallOpts{Context: context.Background()}
 	return h.contractInstance.GetParticipantTracks(opts, roomID, participant)
 }
@@ -2,12 +2,10 @@ package handle
 
 import (
 	"context"
-	"crypto/ecdsa"
 	"errors"
 	"fmt"
 	"log"
 	"math/big"
-	"os"
 	"strings"
 	"sync"
 	"time"
@@ -17,9 +15,7 @@ import (
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient"
-	"github.com/joho/godotenv"
 )
 
 // TransactionRequest represents a transaction request in the queue
@@ -29,55 +25,44 @@ type TransactionRequest struct {
 	Participant  common.Address
 	SessionID    string
 	EventData    []byte
+	Participants []common.Address // recipients of a batched ForwardEventToFrontend
 	ResponseChan chan *TransactionResponse
 }
 
 // TransactionResponse contains the result of a transaction
 type TransactionResponse struct {
-	TxHash common.Hash
-	Error  error
+	TxHash     common.Hash
+	Error      error
+	Deliveries []BatchDelivery // per-recipient results of a batch
+}
+
+// BatchDelivery is the result of one transaction of a batched fan-out
+type BatchDelivery struct {
+	Participant common.Address
+	TxHash      common.Hash
+	Error       error
 }
 
 // SMCallManager manages transactions with a single wallet and queue
 type SMCallManager struct {
 	client       *ethclient.Client
 	contract     *contract.Contract
-	privateKey   *ecdsa.PrivateKey
+	signer       Signer
 	address      common.Address
 	requestQueue []TransactionRequest
 	queueSignal  chan struct{}
 	quitCh       chan struct{}
 	busy         bool
+	gasLedger    *GasLedger
 	mu           sync.Mutex
 }
 
-// NewSMCallManager creates a new SMCallManager
-func NewSMCallManager(client *ethclient.Client, contractAddress common.Address) (*SMCallManager, error) {
-	// Load private key from environment
-	if err := loadEnv(); err != nil {
-		return nil, fmt.Errorf("failed to load environment: %v", err)
-	}
-
-	// Get private key from environment
-	privateKeyStr := os.Getenv("WALLET_PRIVATE_KEY")
-	if privateKeyStr == "" {
-		return nil, fmt.Errorf("WALLET_PRIVATE_KEY not found in environment")
-	}
-
-	// Create ECDSA private key
-	privateKey, err := crypto.HexToECDSA(privateKeyStr)
-	if err != nil {
-		return nil, fmt.Errorf("invalid private key: %v", err)
+// NewSMCallManager creates a new SMCallManager that signs transactions with the given signer
+func NewSMCallManager(client *ethclient.Client, contractAddress common.Address, signer Signer) (*SMCallManager, error) {
+	if signer == nil {
+		return nil, fmt.Errorf("signer is required")
 	}
 
-	// Get wallet address from private key
-	publicKey := privateKey.Public()
-	publicKeyECDSA, ok := publicKey.(*ecdsa.PublicKey)
-	if !ok {
-		return nil, fmt.Errorf("error casting public key to ECDSA")
-	}
-	address := crypto.PubkeyToAddress(*publicKeyECDSA)
-
 	// Create contract instance
 	contractInstance, err := contract.NewContract(contractAddress, client)
 	if err != nil {
@@ -88,8 +73,8 @@ func NewSMCallManager(client *ethclient.Client, contractAddress common.Address)
 	manager := &SMCallManager{
 		client:       client,
 		contract:     contractInstance,
-		privateKey:   privateKey,
-		address:      address,
+		signer:       signer,
+		address:      signer.Address(),
 		requestQueue: make([]TransactionRequest, 0),
 		queueSignal:  make(chan struct{}, 1),
 		quitCh:       make(chan struct{}),
@@ -102,30 +87,6 @@ func NewSMCallManager(client *ethclient.Client, contractAddress common.Address)
 	return manager, nil
 }
 
-// loadEnv loads environment variables from .env files
-func loadEnv() error {
-	paths := []string{
-		".env",       // Current directory
-		"../.env",    // Parent directory
-		"../../.env", // Two levels up
-		"D:/DAppMeetingNew/backend/.env",
-	}
-
-	loaded := false
-	for _, path := range paths {
-		if err := godotenv.Load(path); err == nil {
-			loaded = true
-			break
-		}
-	}
-
-	if !loaded {
-		return fmt.Errorf("no .env file found")
-	}
-
-	return nil
-}
-
 // ForwardEventToFrontend sends an event to the frontend through the smart contract
 func (m *SMCallManager) ForwardEventToFrontend(roomID string, participant common.Address, eventData []byte) (common.Hash, error) {
 	respChan := make(chan *TransactionResponse)
@@ -213,6 +174,39 @@ func (m *SMCallManager) AddNewTrackAfterPublish(roomID string, participant commo
 	return response.TxHash, response.Error
 }
 
+// ForwardEventToParticipants sends the same event to several participants as one batch:
+// the transactions are signed with consecutive nonces and sent before waiting for any receipt
+func (m *SMCallManager) ForwardEventToParticipants(roomID string, participants []common.Address, eventData []byte) []BatchDelivery {
+	if len(participants) == 0 {
+		return nil
+	}
+
+	respChan := make(chan *TransactionResponse)
+	request := TransactionRequest{
+		Method:       "ForwardEventToParticipants",
+		RoomID:       roomID,
+		EventData:    eventData,
+		Participants: participants,
+		ResponseChan: respChan,
+	}
+
+	// Add request to queue
+	m.mu.Lock()
+	m.requestQueue = append(m.requestQueue, request)
+	m.mu.Unlock()
+
+	// Signal the queue processor
+	select {
+	case m.queueSignal <- struct{}{}:
+	default:
+		// Signal already in queue
+	}
+
+	// Wait for response
+	response := <-respChan
+	return response.Deliveries
+}
+
 // processQueue continuously processes the transaction queue
 func (m *SMCallManager) processQueue() {
 	for {
@@ -263,14 +257,15 @@ func (m *SMCallManager) processNextRequest() {
 	go func(req TransactionRequest) {
 		var txHash common.Hash
 		var err error
+		var deliveries []BatchDelivery
 
 		switch req.Method {
 		case "ForwardEventToFrontend":
-			txHash, err = m.executeTransaction(func(auth *bind.TransactOpts) (*types.Transaction, error) {
+			txHash, err = m.executeTransaction(req, func(auth *bind.TransactOpts) (*types.Transaction, error) {
 				return m.contract.ForwardEventToFrontend(auth, req.RoomID, req.Participant, req.EventData)
 			})
 		case "SetParticipantSessionID":
-			txHash, err = m.executeTransaction(func(auth *bind.TransactOpts) (*types.Transaction, error) {
+			txHash, err = m.executeTransaction(req, func(auth *bind.TransactOpts) (*types.Transaction, error) {
 				return m.contract.SetParticipantSessionID(auth, req.RoomID, req.Participant, req.SessionID)
 			})
 		case "AddNewTrackAfterPublish":
@@ -285,18 +280,21 @@ func (m *SMCallManager) processNextRequest() {
 			location := parts[2]
 			isPublished := parts[3] == "true"
 
-			txHash, err = m.executeTransaction(func(auth *bind.TransactOpts) (*types.Transaction, error) {
+			txHash, err = m.executeTransaction(req, func(auth *bind.TransactOpts) (*types.Transaction, error) {
 				return m.contract.AddNewTrackAfterPublish(auth, req.RoomID, req.Participant, req.SessionID,
 					trackName, mid, location, isPublished)
 			})
+		case "ForwardEventToParticipants":
+			deliveries = m.executeBatch(req)
 		default:
 			err = fmt.Errorf("unknown method: %s", req.Method)
 		}
 
 		// Send response
 		req.ResponseChan <- &TransactionResponse{
-			TxHash: txHash,
-			Error:  err,
+			TxHash:     txHash,
+			Error:      err,
+			Deliveries: deliveries,
 		}
 
 		// Mark wallet as available again
@@ -321,7 +319,7 @@ func (m *SMCallManager) processNextRequest() {
 }
 
 // executeTransaction sends a transaction using the wallet
-func (m *SMCallManager) executeTransaction(txnFunc func(*bind.TransactOpts) (*types.Transaction, error)) (common.Hash, error) {
+func (m *SMCallManager) executeTransaction(req TransactionRequest, txnFunc func(*bind.TransactOpts) (*types.Transaction, error)) (common.Hash, error) {
 	// Create transaction options
 	auth, err := m.createTransactionOpts()
 	if err != nil {
@@ -340,6 +338,9 @@ func (m *SMCallManager) executeTransaction(txnFunc func(*bind.TransactOpts) (*ty
 		return tx.Hash(), fmt.Errorf("error waiting for receipt: %v", err)
 	}
 
+	// Record the gas spent, reverted transactions are paid for too
+	m.recordGas(req, tx, receipt)
+
 	// Check transaction status
 	if receipt.Status == 0 {
 		return tx.Hash(), errors.New("transaction reverted")
@@ -348,6 +349,98 @@ func (m *SMCallManager) executeTransaction(txnFunc func(*bind.TransactOpts) (*ty
 	return tx.Hash(), nil
 }
 
+// executeBatch sends one ForwardEventToFrontend transaction per participant with consecutive nonces,
+// then waits for all receipts. A transaction that cannot be sent does not use up its nonce.
+func (m *SMCallManager) executeBatch(req TransactionRequest) []BatchDelivery {
+	deliveries := make([]BatchDelivery, len(req.Participants))
+	for i, participant := range req.Participants {
+		deliveries[i].Participant = participant
+	}
+
+	auth, err := m.createTransactionOpts()
+	if err != nil {
+		for i := range deliveries {
+			deliveries[i].Error = fmt.Errorf("failed to create transaction options: %v", err)
+		}
+		return deliveries
+	}
+
+	nonce := auth.Nonce.Uint64()
+	sent := make([]*types.Transaction, len(deliveries))
+	for i := range deliveries {
+		opts := *auth
+		opts.Nonce = new(big.Int).SetUint64(nonce)
+		tx, err := m.contract.ForwardEventToFrontend(&opts, req.RoomID, deliveries[i].Participant, req.EventData)
+		if err != nil {
+			deliveries[i].Error = fmt.Errorf("transaction failed: %v", err)
+			continue
+		}
+		sent[i] = tx
+		deliveries[i].TxHash = tx.Hash()
+		nonce++
+	}
+
+	for i, tx := range sent {
+		if tx == nil {
+			continue
+		}
+		receipt, err := m.waitForReceipt(tx.Hash())
+		if err != nil {
+			deliveries[i].Error = fmt.Errorf("error waiting for receipt: %v", err)
+			continue
+		}
+
+		// Attribute each transaction of the batch to its recipient in the gas ledger
+		single := req
+		single.Method = "ForwardEventToFrontend"
+		single.Participant = deliveries[i].Participant
+		m.recordGas(single, tx, receipt)
+
+		if receipt.Status == 0 {
+			deliveries[i].Error = errors.New("transaction reverted")
+		}
+	}
+	return deliveries
+}
+
+// recordGas writes the cost of a mined transaction to the gas ledger, if one is configured
+func (m *SMCallManager) recordGas(req TransactionRequest, tx *types.Transaction, receipt *types.Receipt) {
+	if m.gasLedger == nil {
+		return
+	}
+
+	gasPrice := receipt.EffectiveGasPrice
+	if gasPrice == nil {
+		gasPrice = tx.GasPrice()
+	}
+	cost := new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(receipt.GasUsed))
+
+	// Attribute the spend to the frontend message type where there is one
+	eventType := req.Method
+	if req.Method == "ForwardEventToFrontend" {
+		if payloadType := eventDataType(req.EventData); payloadType != "" {
+			eventType = payloadType
+		}
+	}
+
+	entry := GasLedgerEntry{
+		TxHash:            tx.Hash().Hex(),
+		BlockNumber:       receipt.BlockNumber.Uint64(),
+		Timestamp:         time.Now().UTC(),
+		Method:            req.Method,
+		EventType:         eventType,
+		RoomID:            req.RoomID,
+		Participant:       req.Participant.Hex(),
+		GasUsed:           receipt.GasUsed,
+		EffectiveGasPrice: gasPrice.String(),
+		CostWei:           cost.String(),
+		Reverted:          receipt.Status == types.ReceiptStatusFailed,
+	}
+	if err := m.gasLedger.Record(entry); err != nil {
+		log.Printf("Error recording gas usage for %s: %v", tx.Hash().Hex(), err)
+	}
+}
+
 // createTransactionOpts creates transaction options for sending transactions
 func (m *SMCallManager) createTransactionOpts() (*bind.TransactOpts, error) {
 	ctx := context.Background()
@@ -372,10 +465,16 @@ func (m *SMCallManager) createTransactionOpts() (*bind.TransactOpts, error) {
 		log.Printf("Using fallback chain ID: %d", chainID)
 	}
 
-	// Create transaction options with chain ID
-	auth, err := bind.NewKeyedTransactorWithChainID(m.privateKey, chainID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create transactor: %v", err)
+	// Create transaction options that sign through the configured signer backend
+	auth := &bind.TransactOpts{
+		From: m.address,
+		Signer: func(address common.Address, tx *types.Transaction) (*types.Transaction, error) {
+			if address != m.address {
+				return nil, bind.ErrNotAuthorized
+			}
+			return m.signer.SignTx(tx, chainID)
+		},
+		Context: ctx,
 	}
 
 	auth.GasPrice = gasPrice
@@ -409,6 +508,12 @@ func (m *SMCallManager) Close() {
 	close(m.quitCh)
 }
 
+// SetGasLedger enables recording the cost of every mined transaction.
+// It should be called before any transaction is queued.
+func (m *SMCallManager) SetGasLedger(ledger *GasLedger) {
+	m.gasLedger = ledger
+}
+
 // GetQueueLength returns the current length of the transaction queue
 func (m *SMCallManager) GetQueueLength() int {
 	m.mu.Lock()
@@ -0,0 +1,453 @@
+package handle
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	contract "dappmeetingnew/constract"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// maxLongPollWait caps how long a client may wait for a change
+const maxLongPollWait = 60 * time.Second
+
+// APITrack is the JSON representation of a contract track
+type APITrack struct {
+	TrackName   string `json:"trackName"`
+	Mid         string `json:"mid"`
+	Location    string `json:"location"`
+	IsPublished bool   `json:"isPublished"`
+	SessionID   string `json:"sessionId"`
+	RoomID      string `json:"roomId"`
+}
+
+// APIParticipant is the JSON representation of a room participant
+type APIParticipant struct {
+	Address   string     `json:"address"`
+	Name      string     `json:"name"`
+	SessionID string     `json:"sessionId"`
+	Tracks    []APITrack `json:"tracks"`
+}
+
+// APIRoom is the JSON representation of a room
+type APIRoom struct {
+	RoomID       string           `json:"roomId"`
+	Participants []APIParticipant `json:"participants"`
+}
+
+// MetricsSource writes its metrics in the Prometheus text format
+type MetricsSource interface {
+	WriteMetrics(w io.Writer)
+}
+
+// APIServer serves a read-only JSON HTTP API over the cached contract views
+type APIServer struct {
+	cache      *ContractViewCache
+	indexer    *EventIndexer
+	metrics    []MetricsSource
+	corsOrigin string
+	mux        *http.ServeMux
+	server     *http.Server
+}
+
+// NewAPIServer creates an API server listening on addr
+func NewAPIServer(addr string, cache *ContractViewCache, corsOrigin string) *APIServer {
+	s := &APIServer{
+		cache:      cache,
+		corsOrigin: corsOrigin,
+		mux:        http.NewServeMux(),
+	}
+	s.server = &http.Server{
+		Addr:    addr,
+		Handler: s,
+	}
+
+	s.mux.HandleFunc("GET /api/rooms/{roomId}", s.handleRoom)
+	s.mux.HandleFunc("GET /api/rooms/{roomId}/participants", s.handleParticipants)
+	s.mux.HandleFunc("GET /api/rooms/{roomId}/participants/{address}", s.handleParticipant)
+	s.mux.HandleFunc("GET /api/rooms/{roomId}/participants/{address}/tracks", s.handleParticipantTracks)
+	s.mux.HandleFunc("GET /api/rooms/{roomId}/sessions", s.handleSessions)
+	s.mux.HandleFunc("GET /api/rooms/{roomId}/attendance", s.handleAttendance)
+	s.mux.HandleFunc("GET /api/events", s.handleEvents)
+	s.mux.HandleFunc("GET /metrics", s.handleMetrics)
+
+	return s
+}
+
+// SetIndexer enables the historical event queries
+func (s *APIServer) SetIndexer(indexer *EventIndexer) {
+	s.indexer = indexer
+}
+
+// AddMetrics adds a source to the metrics endpoint
+func (s *APIServer) AddMetrics(source MetricsSource) {
+	s.metrics = append(s.metrics, source)
+}
+
+// ServeHTTP adds CORS headers and dispatches to the API routes
+func (s *APIServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.corsOrigin != "" {
+		w.Header().Set("Access-Control-Allow-Origin", s.corsOrigin)
+		w.Header().Set("Access-Control-Allow-Headers", "If-None-Match, Content-Type")
+		w.Header().Set("Access-Control-Expose-Headers", "ETag")
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// ListenAndServe starts serving the API
+func (s *APIServer) ListenAndServe() error {
+	log.Printf("[API] Listening on %s", s.server.Addr)
+	err := s.server.ListenAndServe()
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+// Shutdown gracefully stops the API server
+func (s *APIServer) Shutdown(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
+
+// handleMetrics serves the metrics of every source in the Prometheus text format
+func (s *APIServer) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	for _, source := range s.metrics {
+		source.WriteMetrics(w)
+	}
+}
+
+// handleRoom serves the full room view
+func (s *APIServer) handleRoom(w http.ResponseWriter, r *http.Request) {
+	roomID := r.PathValue("roomId")
+	s.serveRoomView(w, r, roomID, func() (interface{}, error) {
+		details, _, err := s.cache.RoomDetails(roomID)
+		if err != nil {
+			return nil, err
+		}
+		return APIRoom{RoomID: roomID, Participants: toAPIParticipants(details)}, nil
+	})
+}
+
+// handleParticipants serves the participants of a room
+func (s *APIServer) handleParticipants(w http.ResponseWriter, r *http.Request) {
+	roomID := r.PathValue("roomId")
+	s.serveRoomView(w, r, roomID, func() (interface{}, error) {
+		details, _, err := s.cache.RoomDetails(roomID)
+		if err != nil {
+			return nil, err
+		}
+		return toAPIParticipants(details), nil
+	})
+}
+
+// handleParticipant serves one participant of a room
+func (s *APIServer) handleParticipant(w http.ResponseWriter, r *http.Request) {
+	roomID := r.PathValue("roomId")
+	address, ok := parseAddressParam(w, r.PathValue("address"))
+	if !ok {
+		return
+	}
+	s.serveRoomView(w, r, roomID, func() (interface{}, error) {
+		details, _, err := s.cache.RoomDetails(roomID)
+		if err != nil {
+			return nil, err
+		}
+		for _, participant := range toAPIParticipants(details) {
+			if common.HexToAddress(participant.Address) == address {
+				return participant, nil
+			}
+		}
+		return nil, errNotFound
+	})
+}
+
+// handleParticipantTracks serves the tracks of one participant
+func (s *APIServer) handleParticipantTracks(w http.ResponseWriter, r *http.Request) {
+	roomID := r.PathValue("roomId")
+	address, ok := parseAddressParam(w, r.PathValue("address"))
+	if !ok {
+		return
+	}
+	s.serveRoomView(w, r, roomID, func() (interface{}, error) {
+		tracks, _, err := s.cache.ParticipantTracks(roomID, address)
+		if err != nil {
+			return nil, err
+		}
+		return toAPITracks(tracks), nil
+	})
+}
+
+// handleSessions serves the session ID of every participant, keyed by address
+func (s *APIServer) handleSessions(w http.ResponseWriter, r *http.Request) {
+	roomID := r.PathValue("roomId")
+	s.serveRoomView(w, r, roomID, func() (interface{}, error) {
+		details, _, err := s.cache.RoomDetails(roomID)
+		if err != nil {
+			return nil, err
+		}
+		sessions := make(map[string]string, len(details))
+		for _, detail := range details {
+			sessions[detail.WalletAddress.Hex()] = detail.SessionID
+		}
+		return sessions, nil
+	})
+}
+
+// handleEvents serves indexed contract events filtered by room, wallet, event and time range
+func (s *APIServer) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if s.indexer == nil {
+		writeAPIError(w, http.StatusServiceUnavailable, "event index is not enabled")
+		return
+	}
+
+	params := r.URL.Query()
+	query := EventQuery{
+		RoomID: params.Get("room"),
+		Wallet: params.Get("wallet"),
+		Limit:  1000,
+	}
+	if event := params.Get("event"); event != "" {
+		query.EventNames = strings.Split(event, ",")
+	}
+	if query.Wallet != "" && !common.IsHexAddress(query.Wallet) {
+		writeAPIError(w, http.StatusBadRequest, "invalid wallet")
+		return
+	}
+
+	var err error
+	if query.From, err = parseTimeParam(params.Get("from")); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if query.To, err = parseTimeParam(params.Get("to")); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if limit := params.Get("limit"); limit != "" {
+		if _, err := fmt.Sscan(limit, &query.Limit); err != nil || query.Limit <= 0 {
+			writeAPIError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+	}
+
+	events, err := s.indexer.Query(query)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if events == nil {
+		events = []IndexedEvent{}
+	}
+	writeJSON(w, events)
+}
+
+// handleAttendance serves the attendance report of a room as JSON or CSV
+func (s *APIServer) handleAttendance(w http.ResponseWriter, r *http.Request) {
+	if s.indexer == nil {
+		writeAPIError(w, http.StatusServiceUnavailable, "event index is not enabled")
+		return
+	}
+
+	params := r.URL.Query()
+	query := AttendanceQuery{RoomID: r.PathValue("roomId")}
+	var err error
+	if query.From, err = parseTimeParam(params.Get("from")); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if query.To, err = parseTimeParam(params.Get("to")); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if query.SessionEnd, err = parseTimeParam(params.Get("end")); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	report, err := s.indexer.Attendance(query)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	switch params.Get("format") {
+	case "", "json":
+		w.Header().Set("Content-Type", "application/json")
+		WriteAttendanceJSON(w, report)
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="attendance-%s.csv"`, query.RoomID))
+		WriteAttendanceCSV(w, report)
+	default:
+		writeAPIError(w, http.StatusBadRequest, "unknown format")
+	}
+}
+
+// errNotFound marks views that have nothing to return
+var errNotFound = fmt.Errorf("not found")
+
+// serveRoomView renders a view of a room with an ETag. When the client's If-None-Match
+// matches and it asked to wait, the request is held until the room changes or the wait ends.
+func (s *APIServer) serveRoomView(w http.ResponseWriter, r *http.Request, roomID string, view func() (interface{}, error)) {
+	wait, err := parseWaitParam(r.URL.Query().Get("wait"))
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), wait)
+	defer cancel()
+
+	ifNoneMatch := r.Header.Get("If-None-Match")
+	for {
+		version := s.cache.Version(roomID)
+		value, err := view()
+		if err == errNotFound {
+			writeAPIError(w, http.StatusNotFound, "not found")
+			return
+		}
+		if err != nil {
+			writeAPIError(w, http.StatusBadGateway, fmt.Sprintf("contract view failed: %v", err))
+			return
+		}
+
+		body, err := json.Marshal(value)
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		sum := sha256.Sum256(body)
+		etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+		if ifNoneMatch == "" || !etagMatches(ifNoneMatch, etag) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("ETag", etag)
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Write(body)
+			return
+		}
+
+		// Unchanged: answer right away unless the client asked to long-poll
+		if wait == 0 || ctx.Err() != nil {
+			w.Header().Set("ETag", etag)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		s.cache.WaitForChange(ctx, roomID, version)
+	}
+}
+
+// toAPIParticipants converts contract participant details to their JSON representation
+func toAPIParticipants(details []contract.DAppMeetingParticipantDetails) []APIParticipant {
+	participants := make([]APIParticipant, 0, len(details))
+	for _, detail := range details {
+		participants = append(participants, APIParticipant{
+			Address:   detail.WalletAddress.Hex(),
+			Name:      detail.Name,
+			SessionID: detail.SessionID,
+			Tracks:    toAPITracks(detail.Tracks),
+		})
+	}
+	return participants
+}
+
+// toAPITracks converts contract tracks to their JSON representation
+func toAPITracks(tracks []contract.DAppMeetingTrack) []APITrack {
+	apiTracks := make([]APITrack, 0, len(tracks))
+	for _, track := range tracks {
+		apiTracks = append(apiTracks, APITrack{
+			TrackName:   track.TrackName,
+			Mid:         track.Mid,
+			Location:    track.Location,
+			IsPublished: track.IsPublished,
+			SessionID:   track.SessionId,
+			RoomID:      track.RoomId,
+		})
+	}
+	return apiTracks
+}
+
+// parseAddressParam validates a wallet address path parameter
+func parseAddressParam(w http.ResponseWriter, value string) (common.Address, bool) {
+	if !common.IsHexAddress(value) {
+		writeAPIError(w, http.StatusBadRequest, "invalid address")
+		return common.Address{}, false
+	}
+	return common.HexToAddress(value), true
+}
+
+// parseWaitParam parses the long-poll wait duration, given as a Go duration or seconds
+func parseWaitParam(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	wait, err := time.ParseDuration(value)
+	if err != nil {
+		wait, err = time.ParseDuration(value + "s")
+		if err != nil {
+			return 0, fmt.Errorf("invalid wait duration: %s", value)
+		}
+	}
+	if wait < 0 {
+		return 0, fmt.Errorf("invalid wait duration: %s", value)
+	}
+	if wait > maxLongPollWait {
+		wait = maxLongPollWait
+	}
+	return wait, nil
+}
+
+// parseTimeParam parses an RFC 3339 timestamp or a YYYY-MM-DD date, returning the zero time when empty
+func parseTimeParam(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time: %s", value)
+	}
+	return t, nil
+}
+
+// etagMatches reports whether an If-None-Match header matches the ETag
+func etagMatches(header string, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// writeJSON writes a JSON response
+func writeJSON(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(value)
+}
+
+// writeAPIError writes a JSON error response
+func writeAPIError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": message,
+	})
+}
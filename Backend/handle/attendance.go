@@ -0,0 +1,232 @@
+package handle
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	contract "dappmeetingnew/constract"
+)
+
+// AttendanceInterval is one continuous stay of a participant in a room
+type AttendanceInterval struct {
+	JoinedAt           time.Time `json:"joinedAt"`
+	LeftAt             time.Time `json:"leftAt"`
+	DurationSeconds    int64     `json:"durationSeconds"`
+	ClosedAtSessionEnd bool      `json:"closedAtSessionEnd"`
+}
+
+// AttendanceRecord summarizes the attendance of one wallet in a room
+type AttendanceRecord struct {
+	Wallet       string               `json:"wallet"`
+	Name         string               `json:"name"`
+	Intervals    []AttendanceInterval `json:"intervals"`
+	TotalSeconds int64                `json:"totalSeconds"`
+}
+
+// AttendanceReport lists who attended a room and for how long
+type AttendanceReport struct {
+	RoomID       string             `json:"roomId"`
+	SessionStart time.Time          `json:"sessionStart"`
+	SessionEnd   time.Time          `json:"sessionEnd"`
+	Participants []AttendanceRecord `json:"participants"`
+}
+
+// AttendanceQuery selects the events an attendance report is built from
+type AttendanceQuery struct {
+	RoomID     string
+	From       time.Time // only joins and leaves on or after From
+	To         time.Time // only joins and leaves before To
+	SessionEnd time.Time // closes intervals without a leave; defaults to the last room event
+}
+
+// recordParticipantName stores the display name a participant joined with, decoded from its joinRoom transaction
+func (ix *EventIndexer) recordParticipantName(event *contract.ContractParticipantJoined) {
+	name, err := joinRoomName(ix.client, event.Raw.TxHash)
+	if err != nil {
+		log.Printf("[Indexer] Error reading name of %s: %v", event.Participant.Hex(), err)
+		return
+	}
+	if name == "" {
+		return
+	}
+
+	_, err = ix.db.Exec(`INSERT INTO participant_names (room_id, wallet, name, updated_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (room_id, wallet) DO UPDATE SET name = excluded.name, updated_at = excluded.updated_at`,
+		event.RoomId, event.Participant.Hex(), name, time.Now().Unix())
+	if err != nil {
+		log.Printf("[Indexer] Error storing name for %s: %v", event.Participant.Hex(), err)
+	}
+}
+
+// participantNames returns the stored display names of a room, keyed by wallet
+func (ix *EventIndexer) participantNames(roomID string) (map[string]string, error) {
+	rows, err := ix.db.Query(`SELECT wallet, name FROM participant_names WHERE room_id = ?`, roomID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read participant names: %v", err)
+	}
+	defer rows.Close()
+
+	names := make(map[string]string)
+	for rows.Next() {
+		var wallet, name string
+		if err := rows.Scan(&wallet, &name); err != nil {
+			return nil, err
+		}
+		names[wallet] = name
+	}
+	return names, rows.Err()
+}
+
+// lastRoomEventTime returns the block time of the latest indexed event of a room
+func (ix *EventIndexer) lastRoomEventTime(roomID string, before time.Time) (time.Time, error) {
+	statement := `SELECT MAX(block_time) FROM contract_events WHERE room_id = ?`
+	args := []interface{}{roomID}
+	if !before.IsZero() {
+		statement += ` AND block_time < ?`
+		args = append(args, before.Unix())
+	}
+
+	var last *int64
+	if err := ix.db.QueryRow(statement, args...).Scan(&last); err != nil {
+		return time.Time{}, err
+	}
+	if last == nil {
+		return time.Time{}, nil
+	}
+	return time.Unix(*last, 0).UTC(), nil
+}
+
+// Attendance computes attendance intervals per wallet from the indexed join and leave events.
+// Rejoins open a new interval; a participant without a leave is closed at the session end.
+func (ix *EventIndexer) Attendance(query AttendanceQuery) (*AttendanceReport, error) {
+	if query.RoomID == "" {
+		return nil, fmt.Errorf("room ID is required")
+	}
+
+	events, err := ix.Query(EventQuery{
+		RoomID:     query.RoomID,
+		EventNames: []string{EventNameParticipantJoined, EventNameParticipantLeft},
+		From:       query.From,
+		To:         query.To,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sessionEnd := query.SessionEnd
+	if sessionEnd.IsZero() {
+		if sessionEnd, err = ix.lastRoomEventTime(query.RoomID, query.To); err != nil {
+			return nil, err
+		}
+	}
+
+	report := &AttendanceReport{RoomID: query.RoomID, SessionEnd: sessionEnd}
+	if len(events) > 0 {
+		report.SessionStart = events[0].BlockTime
+	}
+
+	records := make(map[string]*AttendanceRecord)
+	openSince := make(map[string]time.Time)
+	for _, event := range events {
+		record, ok := records[event.Wallet]
+		if !ok {
+			record = &AttendanceRecord{Wallet: event.Wallet}
+			records[event.Wallet] = record
+		}
+
+		switch event.EventName {
+		case EventNameParticipantJoined:
+			// A join while already present means the leave fell outside the window; keep the first join
+			if _, present := openSince[event.Wallet]; !present {
+				openSince[event.Wallet] = event.BlockTime
+			}
+		case EventNameParticipantLeft:
+			joinedAt, present := openSince[event.Wallet]
+			if !present {
+				// Joined before the window started
+				joinedAt = report.SessionStart
+				if !query.From.IsZero() {
+					joinedAt = query.From
+				}
+			}
+			record.addInterval(joinedAt, event.BlockTime, false)
+			delete(openSince, event.Wallet)
+		}
+	}
+
+	for wallet, joinedAt := range openSince {
+		end := sessionEnd
+		if end.Before(joinedAt) {
+			end = joinedAt
+		}
+		records[wallet].addInterval(joinedAt, end, true)
+	}
+
+	names, err := ix.participantNames(query.RoomID)
+	if err != nil {
+		return nil, err
+	}
+
+	report.Participants = make([]AttendanceRecord, 0, len(records))
+	for _, record := range records {
+		record.Name = names[record.Wallet]
+		sort.Slice(record.Intervals, func(i, j int) bool {
+			return record.Intervals[i].JoinedAt.Before(record.Intervals[j].JoinedAt)
+		})
+		report.Participants = append(report.Participants, *record)
+	}
+	sort.Slice(report.Participants, func(i, j int) bool {
+		return report.Participants[i].Wallet < report.Participants[j].Wallet
+	})
+	return report, nil
+}
+
+// addInterval appends an interval and updates the total
+func (r *AttendanceRecord) addInterval(joinedAt time.Time, leftAt time.Time, closedAtSessionEnd bool) {
+	duration := int64(leftAt.Sub(joinedAt) / time.Second)
+	if duration < 0 {
+		duration = 0
+	}
+	r.Intervals = append(r.Intervals, AttendanceInterval{
+		JoinedAt:           joinedAt,
+		LeftAt:             leftAt,
+		DurationSeconds:    duration,
+		ClosedAtSessionEnd: closedAtSessionEnd,
+	})
+	r.TotalSeconds += duration
+}
+
+// WriteAttendanceCSV writes one CSV row per attendance interval
+func WriteAttendanceCSV(w io.Writer, report *AttendanceReport) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"room_id", "wallet", "name", "joined_at", "left_at", "duration_seconds", "closed_at_session_end", "total_seconds"})
+	for _, record := range report.Participants {
+		for _, interval := range record.Intervals {
+			writer.Write([]string{
+				report.RoomID,
+				record.Wallet,
+				record.Name,
+				interval.JoinedAt.Format(time.RFC3339),
+				interval.LeftAt.Format(time.RFC3339),
+				strconv.FormatInt(interval.DurationSeconds, 10),
+				strconv.FormatBool(interval.ClosedAtSessionEnd),
+				strconv.FormatInt(record.TotalSeconds, 10),
+			})
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// WriteAttendanceJSON writes the report as indented JSON
+func WriteAttendanceJSON(w io.Writer, report *AttendanceReport) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
@@ -0,0 +1,156 @@
+package handle
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Chat history page sizes. Pages are relayed in a transaction, so besides the message count they
+// are capped by their encoded size to stay well below the node's transaction size and our gas limit.
+const (
+	DefaultChatHistoryLimit = 50
+	MaxChatHistoryLimit     = 200
+	MaxChatHistoryBytes     = 32 * 1024
+)
+
+// chatSchema creates the chat message table
+var chatSchema = []string{
+	`CREATE TABLE IF NOT EXISTS chat_messages (
+		id          INTEGER PRIMARY KEY AUTOINCREMENT,
+		room_id     TEXT    NOT NULL,
+		sender      TEXT    NOT NULL,
+		sender_name TEXT    NOT NULL,
+		message     TEXT    NOT NULL,
+		request_id  TEXT    NOT NULL,
+		sent_at     INTEGER NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_chat_messages_room ON chat_messages (room_id, id)`,
+}
+
+// ChatMessage is one stored chat message
+type ChatMessage struct {
+	ID         int64  `json:"id" doc:"Message ID, increasing within the backend"`
+	RoomID     string `json:"roomId" doc:"Room the message was sent in"`
+	Sender     string `json:"sender" doc:"Wallet address of the sender"`
+	SenderName string `json:"senderName" doc:"Display name of the sender when the message was sent"`
+	Message    string `json:"message" doc:"Message text"`
+	Timestamp  int64  `json:"timestamp" doc:"Time the backend stored the message, in milliseconds since the epoch"`
+}
+
+// ChatStore keeps the chat history of every room
+type ChatStore struct {
+	db *sql.DB
+}
+
+// NewChatStore creates the store on the shared database
+func NewChatStore(db *sql.DB) (*ChatStore, error) {
+	if err := migrate(db, chatSchema); err != nil {
+		return nil, err
+	}
+	return &ChatStore{db: db}, nil
+}
+
+// Add stores a message. A message already stored for the same request ID is returned instead,
+// so a retried chat-send is not stored twice.
+func (s *ChatStore) Add(roomID string, sender common.Address, senderName string, message string, requestID string) (ChatMessage, error) {
+	stored, err := s.query(`WHERE room_id = ? AND sender = ? AND request_id = ?`, roomID, sender.Hex(), requestID)
+	if err != nil {
+		return ChatMessage{}, err
+	}
+	if len(stored) > 0 {
+		return stored[0], nil
+	}
+
+	chat := ChatMessage{
+		RoomID:     roomID,
+		Sender:     sender.Hex(),
+		SenderName: senderName,
+		Message:    message,
+		Timestamp:  time.Now().UnixMilli(),
+	}
+	result, err := s.db.Exec(`INSERT INTO chat_messages (room_id, sender, sender_name, message, request_id, sent_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		chat.RoomID, chat.Sender, chat.SenderName, chat.Message, requestID, chat.Timestamp)
+	if err != nil {
+		return chat, fmt.Errorf("error storing chat message: %v", err)
+	}
+	chat.ID, _ = result.LastInsertId()
+	return chat, nil
+}
+
+// History returns up to limit messages of a room older than the before ID (0 for the newest),
+// oldest first, and whether older messages remain. The oldest messages are left out when the
+// page would encode to more than MaxChatHistoryBytes.
+func (s *ChatStore) History(roomID string, before int64, limit int) ([]ChatMessage, bool, error) {
+	if limit <= 0 {
+		limit = DefaultChatHistoryLimit
+	}
+	if limit > MaxChatHistoryLimit {
+		limit = MaxChatHistoryLimit
+	}
+
+	var messages []ChatMessage
+	var err error
+	if before > 0 {
+		messages, err = s.query(`WHERE room_id = ? AND id < ? ORDER BY id DESC LIMIT ?`, roomID, before, limit+1)
+	} else {
+		messages, err = s.query(`WHERE room_id = ? ORDER BY id DESC LIMIT ?`, roomID, limit+1)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	hasMore := len(messages) > limit
+	if hasMore {
+		messages = messages[:limit]
+	}
+	if fit := fitChatHistory(messages); fit < len(messages) {
+		messages = messages[:fit]
+		hasMore = true
+	}
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	if messages == nil {
+		messages = []ChatMessage{}
+	}
+	return messages, hasMore, nil
+}
+
+// fitChatHistory returns how many of the messages, newest first, encode within MaxChatHistoryBytes
+func fitChatHistory(messages []ChatMessage) int {
+	size := 0
+	for i, chat := range messages {
+		encoded, err := json.Marshal(chat)
+		if err != nil {
+			return i
+		}
+		size += len(encoded) + 1
+		if size > MaxChatHistoryBytes {
+			return i
+		}
+	}
+	return len(messages)
+}
+
+// query reads chat messages matching the SQL suffix
+func (s *ChatStore) query(suffix string, args ...interface{}) ([]ChatMessage, error) {
+	rows, err := s.db.Query(`SELECT id, room_id, sender, sender_name, message, sent_at FROM chat_messages `+suffix, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error reading chat messages: %v", err)
+	}
+	defer rows.Close()
+
+	var messages []ChatMessage
+	for rows.Next() {
+		var chat ChatMessage
+		if err := rows.Scan(&chat.ID, &chat.RoomID, &chat.Sender, &chat.SenderName, &chat.Message, &chat.Timestamp); err != nil {
+			return nil, err
+		}
+		messages = append(messages, chat)
+	}
+	return messages, rows.Err()
+}
@@ -5,6 +5,7 @@ import (
 	"compress/zlib"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -25,6 +26,18 @@ type CloudflareResponse struct {
 	Result           map[string]interface{} `json:"result"`
 }
 
+// CloudflareAPIError is an error answered by the Cloudflare API, as opposed to a failure to reach it
+type CloudflareAPIError struct {
+	StatusCode  int
+	Code        string
+	Description string
+}
+
+// Error implements the error interface
+func (e *CloudflareAPIError) Error() string {
+	return fmt.Sprintf("Cloudflare API error: %s", e.Description)
+}
+
 // NewCloudflareService creates a new Cloudflare service instance
 func NewCloudflareService(baseURL, appID, appSecret string) *CloudflareService {
 	return &CloudflareService{
@@ -69,12 +82,15 @@ func (cs *CloudflareService) makeCloudflareRequest(method string, path string, b
 
 	var cfResp CloudflareResponse
 	if err := json.Unmarshal(respBody, &cfResp); err != nil {
+		if resp.StatusCode >= http.StatusBadRequest {
+			return nil, &CloudflareAPIError{StatusCode: resp.StatusCode, Description: string(respBody)}
+		}
 		return nil, fmt.Errorf("error parsing response: %v", err)
 	}
 
 	// Check for Cloudflare error
 	if cfResp.ErrorCode != nil {
-		return nil, fmt.Errorf("Cloudflare API error: %s", cfResp.ErrorDescription)
+		return nil, &CloudflareAPIError{StatusCode: resp.StatusCode, Code: *cfResp.ErrorCode, Description: cfResp.ErrorDescription}
 	}
 
 	// For session creation, return a map with sessionId
@@ -214,6 +230,54 @@ func (cs *CloudflareService) PullTracks(sessionID string, tracks []map[string]in
 	return response, nil
 }
 
+// PublishDataChannels opens data channels the session writes to
+func (cs *CloudflareService) PublishDataChannels(sessionID string, names []string) (map[string]interface{}, error) {
+	channels := make([]map[string]interface{}, len(names))
+	for i, name := range names {
+		channels[i] = map[string]interface{}{
+			"location":        "local",
+			"dataChannelName": name,
+		}
+	}
+	return cs.newDataChannels(sessionID, channels)
+}
+
+// SubscribeDataChannels opens data channels of remote sessions for the session to read
+func (cs *CloudflareService) SubscribeDataChannels(sessionID string, channels []map[string]interface{}) (map[string]interface{}, error) {
+	for _, channel := range channels {
+		if _, ok := channel["dataChannelName"]; !ok {
+			return nil, fmt.Errorf("dataChannelName must be present in data channel data")
+		}
+		if _, ok := channel["sessionId"]; !ok {
+			return nil, fmt.Errorf("sessionId must be present when subscribing to remote data channels")
+		}
+		channel["location"] = "remote"
+	}
+	return cs.newDataChannels(sessionID, channels)
+}
+
+// newDataChannels adds data channels to a session
+func (cs *CloudflareService) newDataChannels(sessionID string, channels []map[string]interface{}) (map[string]interface{}, error) {
+	url := fmt.Sprintf("/sessions/%s/datachannels/new", sessionID)
+
+	requestBody := map[string]interface{}{
+		"dataChannels": channels,
+	}
+
+	return cs.makeCloudflareRequest("POST", url, requestBody)
+}
+
+// UpdateTracks changes tracks of a session in place, such as the simulcast layer of a pulled track
+func (cs *CloudflareService) UpdateTracks(sessionID string, tracks []map[string]interface{}) (map[string]interface{}, error) {
+	url := fmt.Sprintf("/sessions/%s/tracks/update", sessionID)
+
+	requestBody := map[string]interface{}{
+		"tracks": tracks,
+	}
+
+	return cs.makeCloudflareRequest("PUT", url, requestBody)
+}
+
 // Renegotiate performs renegotiation for a session
 func (cs *CloudflareService) Renegotiate(sessionID string, sessionDescription map[string]interface{}) (map[string]interface{}, error) {
 	url := fmt.Sprintf("/sessions/%s/renegotiate", sessionID)
@@ -244,6 +308,63 @@ func (cs *CloudflareService) GetSessionState(sessionID string) (map[string]inter
 	return cs.makeCloudflareRequest("GET", url, nil)
 }
 
+// SessionExists reports whether Cloudflare still knows a session. A session the API rejects
+// has expired or was closed; an error is returned when the API could not be reached or failed.
+func (cs *CloudflareService) SessionExists(sessionID string) (bool, error) {
+	_, err := cs.GetSessionState(sessionID)
+	if sessionGone(err) {
+		log.Printf("[Cloudflare API] Session %s is gone: %v", sessionID, err)
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error reading state of session %s: %v", sessionID, err)
+	}
+	return true, nil
+}
+
+// sessionGone reports whether a session request failed because Cloudflare rejected the session,
+// rather than because the API could not be reached or failed
+func sessionGone(err error) bool {
+	var apiErr *CloudflareAPIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode < http.StatusInternalServerError
+}
+
+// CloseLocalTracks force-closes the live local tracks of a session and returns their names
+func (cs *CloudflareService) CloseLocalTracks(sessionID string) ([]string, error) {
+	state, err := cs.GetSessionState(sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("error reading state of session %s: %v", sessionID, err)
+	}
+
+	var tracks []map[string]string
+	var names []string
+	stateTracks, _ := state["tracks"].([]interface{})
+	for _, stateTrack := range stateTracks {
+		track, ok := stateTrack.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		mid, _ := track["mid"].(string)
+		location, _ := track["location"].(string)
+		status, _ := track["status"].(string)
+		if mid == "" || location != "local" || status == "inactive" {
+			continue
+		}
+		tracks = append(tracks, map[string]string{"mid": mid})
+		if name, ok := track["trackName"].(string); ok {
+			names = append(names, name)
+		}
+	}
+	if len(tracks) == 0 {
+		return nil, nil
+	}
+
+	if _, err := cs.CloseTracks(sessionID, tracks, true, nil); err != nil {
+		return nil, fmt.Errorf("error closing %d tracks of session %s: %v", len(tracks), sessionID, err)
+	}
+	return names, nil
+}
+
 // decompress decompresses zlib-compressed base64-encoded data
 func (cs *CloudflareService) decompressZlib(compressedB64 string) (string, error) {
 	// Decode base64
@@ -0,0 +1,184 @@
+package handle
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	contract "dappmeetingnew/constract"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// maxCachedRooms bounds the rooms kept in a ContractViewCache; the least recently used room is evicted beyond it
+const maxCachedRooms = 1024
+
+// roomViewEntry caches the contract views of one room
+type roomViewEntry struct {
+	details   []contract.DAppMeetingParticipantDetails
+	loaded    bool
+	fetchedAt time.Time
+	usedAt    time.Time
+	tracks    map[common.Address][]contract.DAppMeetingTrack
+	version   uint64
+	changed   chan struct{}
+}
+
+// ContractViewCache caches the room and track contract views and is invalidated by contract events
+type ContractViewCache struct {
+	contractInstance *contract.Contract
+	ttl              time.Duration
+	rooms            map[string]*roomViewEntry
+	mu               sync.Mutex
+}
+
+// NewContractViewCache creates a cache whose entries are refetched after ttl even without events
+func NewContractViewCache(contractInstance *contract.Contract, ttl time.Duration) *ContractViewCache {
+	return &ContractViewCache{
+		contractInstance: contractInstance,
+		ttl:              ttl,
+		rooms:            make(map[string]*roomViewEntry),
+	}
+}
+
+// entryLocked returns the cache entry for a room, creating it if needed and evicting the least
+// recently used room when the cache is full; c.mu must be held
+func (c *ContractViewCache) entryLocked(roomID string) *roomViewEntry {
+	entry, ok := c.rooms[roomID]
+	if !ok {
+		if len(c.rooms) >= maxCachedRooms {
+			c.evictLocked()
+		}
+		entry = &roomViewEntry{
+			tracks:  make(map[common.Address][]contract.DAppMeetingTrack),
+			changed: make(chan struct{}),
+		}
+		c.rooms[roomID] = entry
+	}
+	entry.usedAt = time.Now()
+	return entry
+}
+
+// evictLocked drops the least recently used room. Its waiters are woken and see the version
+// of a fresh entry, so they refetch the room; c.mu must be held.
+func (c *ContractViewCache) evictLocked() {
+	var oldestID string
+	var oldest *roomViewEntry
+	for roomID, entry := range c.rooms {
+		if oldest == nil || entry.usedAt.Before(oldest.usedAt) {
+			oldestID, oldest = roomID, entry
+		}
+	}
+	if oldest != nil {
+		close(oldest.changed)
+		delete(c.rooms, oldestID)
+	}
+}
+
+// RoomDetails returns the participants of a room as reported by GetRoomParticipantsDetails,
+// together with the cache version of the room
+func (c *ContractViewCache) RoomDetails(roomID string) ([]contract.DAppMeetingParticipantDetails, uint64, error) {
+	c.mu.Lock()
+	entry := c.entryLocked(roomID)
+	if entry.loaded && (c.ttl <= 0 || time.Since(entry.fetchedAt) < c.ttl) {
+		details, version := entry.details, entry.version
+		c.mu.Unlock()
+		return details, version, nil
+	}
+	version := entry.version
+	c.mu.Unlock()
+
+	opts := &bind.CallOpts{Context: context.Background()}
+	details, err := c.contractInstance.GetRoomParticipantsDetails(opts, roomID)
+	if err != nil {
+		return nil, version, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry = c.entryLocked(roomID)
+	// Only store the result if no event invalidated the room while we were fetching
+	if entry.version == version {
+		entry.details = details
+		entry.loaded = true
+		entry.fetchedAt = time.Now()
+	}
+	return details, version, nil
+}
+
+// ParticipantTracks returns a participant's tracks as reported by GetParticipantTracks
+func (c *ContractViewCache) ParticipantTracks(roomID string, participant common.Address) ([]contract.DAppMeetingTrack, uint64, error) {
+	c.mu.Lock()
+	entry := c.entryLocked(roomID)
+	if tracks, ok := entry.tracks[participant]; ok && (c.ttl <= 0 || time.Since(entry.fetchedAt) < c.ttl) {
+		version := entry.version
+		c.mu.Unlock()
+		return tracks, version, nil
+	}
+	version := entry.version
+	c.mu.Unlock()
+
+	opts := &bind.CallOpts{Context: context.Background()}
+	tracks, err := c.contractInstance.GetParticipantTracks(opts, roomID, participant)
+	if err != nil {
+		return nil, version, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry = c.entryLocked(roomID)
+	if entry.version == version {
+		entry.tracks[participant] = tracks
+		if !entry.loaded {
+			entry.fetchedAt = time.Now()
+		}
+	}
+	return tracks, version, nil
+}
+
+// Invalidate drops the cached views of a room and wakes clients waiting for a change.
+// Rooms nobody asked about have nothing to invalidate.
+func (c *ContractViewCache) Invalidate(roomID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.rooms[roomID]
+	if !ok {
+		return
+	}
+	entry.details = nil
+	entry.loaded = false
+	entry.tracks = make(map[common.Address][]contract.DAppMeetingTrack)
+	entry.version++
+	close(entry.changed)
+	entry.changed = make(chan struct{})
+}
+
+// Version returns the current cache version of a room
+func (c *ContractViewCache) Version(roomID string) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.entryLocked(roomID).version
+}
+
+// WaitForChange blocks until the room version differs from the given one or the context ends,
+// and returns the room version at that point
+func (c *ContractViewCache) WaitForChange(ctx context.Context, roomID string, version uint64) uint64 {
+	for {
+		c.mu.Lock()
+		entry := c.entryLocked(roomID)
+		current, changed := entry.version, entry.changed
+		c.mu.Unlock()
+
+		if current != version {
+			return current
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return current
+		}
+	}
+}
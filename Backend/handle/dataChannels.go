@@ -0,0 +1,120 @@
+package handle
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// handlePublishDataChannel opens data channels in the sender's session and records each of them on
+// the contract as a track with the datachannel location, so the room can discover and subscribe to them
+func (h *EventHandler) handlePublishDataChannel(ctx *MessageContext, request PublishDataChannelRequest) error {
+	ctx.Logf("Opening %d data channels in session %s for %s", len(request.DataChannels), request.SessionID, ctx.Sender.Hex())
+
+	if err := h.verifySession(ctx, request.SessionID); err != nil {
+		return err
+	}
+
+	response, err := RunStep(ctx, "create-datachannels", func() (map[string]interface{}, error) {
+		return h.cloudflareService.PublishDataChannels(request.SessionID, request.DataChannels)
+	})
+	if err != nil {
+		return NewMessageError(ErrCodeCloudflare, "error opening data channels: %v", err)
+	}
+
+	_, err = RunStep(ctx, "forward-response", func() (common.Hash, error) {
+		return h.forwardToFrontend(ctx.RoomID, ctx.Sender, DataChannelResponse{
+			MessageHeader:    responseHeader("publish-datachannel-response", ctx.RequestID),
+			ResponseEnvelope: successEnvelope("publish-datachannel"),
+			SessionID:        request.SessionID,
+			DataChannels:     response["dataChannels"],
+		}, false)
+	})
+	if err != nil {
+		return NewMessageError(ErrCodeContract, "error forwarding response to frontend: %v", err)
+	}
+
+	var announced []AvailableTrack
+	channels, _ := response["dataChannels"].([]interface{})
+	for _, cfChannel := range channels {
+		channel, ok := cfChannel.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _ := channel["dataChannelName"].(string)
+		id, ok := channel["id"]
+		if name == "" || !ok {
+			continue
+		}
+		channelID := fmt.Sprint(id)
+
+		txHash, err := RunStep(ctx, "add-datachannel:"+name, func() (common.Hash, error) {
+			return h.smCallManager.AddNewTrackAfterPublish(ctx.RoomID, ctx.Sender, request.SessionID,
+				name, channelID, DataChannelLocation, true)
+		})
+		if err != nil {
+			ctx.Logf("Error adding data channel %s to smart contract: %v", name, err)
+			continue
+		}
+		ctx.Logf("Added data channel %s (id %s) to smart contract, txHash: %s", name, channelID, txHash)
+		h.recordTrack(ctx, request.SessionID, name, channelID, DataChannelLocation)
+		announced = append(announced, AvailableTrack{TrackName: name, Mid: channelID, Location: DataChannelLocation})
+	}
+	h.announceTracks(ctx, ctx.Sender, request.SessionID, announced)
+	return nil
+}
+
+// handleSubscribeDataChannel opens data channels published in the room for the sender's session to read.
+// Only channels recorded on the contract by a participant of the room can be subscribed to.
+func (h *EventHandler) handleSubscribeDataChannel(ctx *MessageContext, request SubscribeDataChannelRequest) error {
+	ctx.Logf("Subscribing session %s of %s to %d data channels", request.SessionID, ctx.Sender.Hex(), len(request.DataChannels))
+
+	if err := h.verifySession(ctx, request.SessionID); err != nil {
+		return err
+	}
+
+	participants, err := h.roomParticipants(ctx.RoomID)
+	if err != nil {
+		return NewMessageError(ErrCodeContract, "error reading participants of room %s: %v", ctx.RoomID, err)
+	}
+	published := make(map[string]bool)
+	for _, participant := range participants {
+		for _, track := range participant.Tracks {
+			if track.Location == DataChannelLocation {
+				published[track.SessionId+"/"+track.TrackName] = true
+			}
+		}
+	}
+
+	channels := make([]map[string]interface{}, len(request.DataChannels))
+	for i, channel := range request.DataChannels {
+		if !published[channel.SessionID+"/"+channel.DataChannelName] {
+			return NewMessageError(ErrCodeInvalidRequest, "data channel %s of session %s is not published in room %s",
+				channel.DataChannelName, channel.SessionID, ctx.RoomID)
+		}
+		channels[i] = map[string]interface{}{
+			"sessionId":       channel.SessionID,
+			"dataChannelName": channel.DataChannelName,
+		}
+	}
+
+	response, err := RunStep(ctx, "subscribe-datachannels", func() (map[string]interface{}, error) {
+		return h.cloudflareService.SubscribeDataChannels(request.SessionID, channels)
+	})
+	if err != nil {
+		return NewMessageError(ErrCodeCloudflare, "error subscribing to data channels: %v", err)
+	}
+
+	_, err = RunStep(ctx, "forward-response", func() (common.Hash, error) {
+		return h.forwardToFrontend(ctx.RoomID, ctx.Sender, DataChannelResponse{
+			MessageHeader:    responseHeader("subscribe-datachannel-response", ctx.RequestID),
+			ResponseEnvelope: successEnvelope("subscribe-datachannel"),
+			SessionID:        request.SessionID,
+			DataChannels:     response["dataChannels"],
+		}, false)
+	})
+	if err != nil {
+		return NewMessageError(ErrCodeContract, "error forwarding response to frontend: %v", err)
+	}
+	return nil
+}
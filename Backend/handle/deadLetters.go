@@ -0,0 +1,347 @@
+package handle
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Dead letter states
+const (
+	DeadLetterPending        = "pending"
+	DeadLetterRetryRequested = "retry_requested"
+	DeadLetterResolved       = "resolved"
+	DeadLetterDiscarded      = "discarded"
+)
+
+// deadLetterCodes are the server-side failures worth keeping for a retry;
+// invalid or unauthorized requests would fail the same way again
+var deadLetterCodes = map[string]bool{
+	ErrCodeSessionFailed: true,
+	ErrCodeCloudflare:    true,
+	ErrCodeContract:      true,
+	ErrCodeInternal:      true,
+}
+
+// deadLetterSchema creates the dead letter and step checkpoint tables
+var deadLetterSchema = []string{
+	`CREATE TABLE IF NOT EXISTS dead_letters (
+		id           INTEGER PRIMARY KEY AUTOINCREMENT,
+		event_name   TEXT    NOT NULL,
+		room_id      TEXT    NOT NULL,
+		wallet       TEXT    NOT NULL,
+		tx_hash      TEXT    NOT NULL,
+		log_index    INTEGER NOT NULL,
+		block_number INTEGER NOT NULL,
+		request_id   TEXT    NOT NULL,
+		request_type TEXT    NOT NULL,
+		raw_log      TEXT    NOT NULL,
+		payload      TEXT    NOT NULL,
+		failed_step  TEXT    NOT NULL,
+		error_code   TEXT    NOT NULL,
+		error        TEXT    NOT NULL,
+		attempts     INTEGER NOT NULL DEFAULT 1,
+		status       TEXT    NOT NULL,
+		created_at   INTEGER NOT NULL,
+		updated_at   INTEGER NOT NULL,
+		UNIQUE (tx_hash, log_index)
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_dead_letters_status ON dead_letters (status)`,
+	`CREATE TABLE IF NOT EXISTS handler_steps (
+		request_key  TEXT    NOT NULL,
+		step         TEXT    NOT NULL,
+		result       TEXT    NOT NULL,
+		completed_at INTEGER NOT NULL,
+		PRIMARY KEY (request_key, step)
+	)`,
+}
+
+// DeadLetter is a failed event kept for inspection and retry
+type DeadLetter struct {
+	ID          int64           `json:"id"`
+	EventName   string          `json:"eventName"`
+	RoomID      string          `json:"roomId"`
+	Wallet      string          `json:"wallet"`
+	TxHash      string          `json:"txHash"`
+	LogIndex    uint            `json:"logIndex"`
+	BlockNumber uint64          `json:"blockNumber"`
+	RequestID   string          `json:"requestId"`
+	RequestType string          `json:"requestType"`
+	RawLog      json.RawMessage `json:"rawLog"`
+	Payload     json.RawMessage `json:"payload"`
+	FailedStep  string          `json:"failedStep"`
+	ErrorCode   string          `json:"errorCode"`
+	Error       string          `json:"error"`
+	Attempts    int             `json:"attempts"`
+	Status      string          `json:"status"`
+	CreatedAt   time.Time       `json:"createdAt"`
+	UpdatedAt   time.Time       `json:"updatedAt"`
+	Steps       []HandlerStep   `json:"steps,omitempty"`
+}
+
+// requestKey returns the checkpoint key of the failed request, its <txHash>:<logIndex>
+func (l DeadLetter) requestKey() string {
+	return fmt.Sprintf("%s:%d", l.TxHash, l.LogIndex)
+}
+
+// RawEvent decodes the stored raw log
+func (l DeadLetter) RawEvent() (types.Log, error) {
+	var raw types.Log
+	if err := json.Unmarshal(l.RawLog, &raw); err != nil {
+		return raw, fmt.Errorf("error decoding raw log of dead letter %d: %v", l.ID, err)
+	}
+	return raw, nil
+}
+
+// HandlerStep is a completed handler step whose result is reused by retries
+type HandlerStep struct {
+	Step        string          `json:"step"`
+	Result      json.RawMessage `json:"result"`
+	CompletedAt time.Time       `json:"completedAt"`
+}
+
+// DeadLetterStore keeps failed events and the step checkpoints of in-flight requests
+type DeadLetterStore struct {
+	db *sql.DB
+}
+
+// NewDeadLetterStore creates the store on the shared database
+func NewDeadLetterStore(db *sql.DB) (*DeadLetterStore, error) {
+	if err := migrate(db, deadLetterSchema); err != nil {
+		return nil, err
+	}
+	return &DeadLetterStore{db: db}, nil
+}
+
+// Add stores a failed event, or updates the error of an event that failed before
+func (s *DeadLetterStore) Add(ctx *MessageContext, eventName string, messageErr *MessageError) error {
+	rawLog, err := json.Marshal(ctx.Raw)
+	if err != nil {
+		return fmt.Errorf("error marshaling raw log: %v", err)
+	}
+	payload, err := json.Marshal(ctx.Payload)
+	if err != nil {
+		return fmt.Errorf("error marshaling payload: %v", err)
+	}
+
+	now := time.Now().Unix()
+	_, err = s.db.Exec(`INSERT INTO dead_letters
+		(event_name, room_id, wallet, tx_hash, log_index, block_number, request_id, request_type,
+		 raw_log, payload, failed_step, error_code, error, status, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (tx_hash, log_index) DO UPDATE SET
+			failed_step = excluded.failed_step, error_code = excluded.error_code, error = excluded.error,
+			attempts = attempts + 1, status = excluded.status, updated_at = excluded.updated_at`,
+		eventName, ctx.RoomID, ctx.Sender.Hex(), ctx.Raw.TxHash.Hex(), ctx.Raw.Index, ctx.Raw.BlockNumber,
+		ctx.RequestID, ctx.Type, string(rawLog), string(payload), ctx.failedStep, messageErr.Code, messageErr.Message,
+		DeadLetterPending, now, now)
+	if err != nil {
+		return fmt.Errorf("error storing dead letter: %v", err)
+	}
+	return nil
+}
+
+// List returns dead letters, newest first, optionally filtered by status
+func (s *DeadLetterStore) List(status string, limit int) ([]DeadLetter, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+	if status == "" {
+		return s.query(`ORDER BY id DESC LIMIT ?`, limit)
+	}
+	return s.query(`WHERE status = ? ORDER BY id DESC LIMIT ?`, status, limit)
+}
+
+// Get returns one dead letter with the steps that already completed
+func (s *DeadLetterStore) Get(id int64) (*DeadLetter, error) {
+	letters, err := s.query(`WHERE id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(letters) == 0 {
+		return nil, fmt.Errorf("dead letter %d not found", id)
+	}
+
+	letter := letters[0]
+	if letter.Steps, err = s.steps(letter.requestKey()); err != nil {
+		return nil, err
+	}
+	return &letter, nil
+}
+
+// RequestRetry marks a dead letter for the running backend to retry
+func (s *DeadLetterStore) RequestRetry(id int64) error {
+	return s.setStatus(id, DeadLetterRetryRequested, DeadLetterPending, DeadLetterRetryRequested)
+}
+
+// Discard drops a dead letter from the retry queue and forgets its checkpoints
+func (s *DeadLetterStore) Discard(id int64) error {
+	letter, err := s.Get(id)
+	if err != nil {
+		return err
+	}
+	if err := s.setStatus(id, DeadLetterDiscarded, DeadLetterPending, DeadLetterRetryRequested); err != nil {
+		return err
+	}
+	return s.ClearSteps(letter.requestKey())
+}
+
+// Resolve marks a dead letter as handled by a successful retry
+func (s *DeadLetterStore) Resolve(id int64) error {
+	return s.setStatus(id, DeadLetterResolved, DeadLetterPending, DeadLetterRetryRequested)
+}
+
+// Release returns a dead letter whose retry failed without storing it again to pending
+func (s *DeadLetterStore) Release(id int64) error {
+	_, err := s.db.Exec(`UPDATE dead_letters SET status = ?, updated_at = ? WHERE id = ? AND status = ?`,
+		DeadLetterPending, time.Now().Unix(), id, DeadLetterRetryRequested)
+	return err
+}
+
+// RetryRequested returns the dead letters waiting for a retry
+func (s *DeadLetterStore) RetryRequested() ([]DeadLetter, error) {
+	return s.query(`WHERE status = ? ORDER BY id`, DeadLetterRetryRequested)
+}
+
+// setStatus moves a dead letter to a new status if it is in one of the allowed states
+func (s *DeadLetterStore) setStatus(id int64, status string, from ...string) error {
+	args := []interface{}{status, time.Now().Unix(), id}
+	for _, fromStatus := range from {
+		args = append(args, fromStatus)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(from)), ", ")
+	result, err := s.db.Exec(`UPDATE dead_letters SET status = ?, updated_at = ? WHERE id = ? AND status IN (`+placeholders+`)`, args...)
+	if err != nil {
+		return fmt.Errorf("error updating dead letter %d: %v", id, err)
+	}
+	if count, _ := result.RowsAffected(); count == 0 {
+		return fmt.Errorf("dead letter %d not found or already %s", id, status)
+	}
+	return nil
+}
+
+// query reads dead letters matching the SQL suffix
+func (s *DeadLetterStore) query(suffix string, args ...interface{}) ([]DeadLetter, error) {
+	rows, err := s.db.Query(`SELECT id, event_name, room_id, wallet, tx_hash, log_index, block_number,
+		request_id, request_type, raw_log, payload, failed_step, error_code, error, attempts, status,
+		created_at, updated_at FROM dead_letters `+suffix, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var letters []DeadLetter
+	for rows.Next() {
+		var letter DeadLetter
+		var rawLog, payload string
+		var createdAt, updatedAt int64
+		if err := rows.Scan(&letter.ID, &letter.EventName, &letter.RoomID, &letter.Wallet, &letter.TxHash,
+			&letter.LogIndex, &letter.BlockNumber, &letter.RequestID, &letter.RequestType, &rawLog, &payload,
+			&letter.FailedStep, &letter.ErrorCode, &letter.Error, &letter.Attempts, &letter.Status,
+			&createdAt, &updatedAt); err != nil {
+			return nil, err
+		}
+		letter.RawLog = json.RawMessage(rawLog)
+		letter.Payload = json.RawMessage(payload)
+		letter.CreatedAt = time.Unix(createdAt, 0).UTC()
+		letter.UpdatedAt = time.Unix(updatedAt, 0).UTC()
+		letters = append(letters, letter)
+	}
+	return letters, rows.Err()
+}
+
+// CompletedStep returns the stored result of a step that already completed for the request
+func (s *DeadLetterStore) CompletedStep(requestKey string, step string) (json.RawMessage, bool, error) {
+	var result string
+	err := s.db.QueryRow(`SELECT result FROM handler_steps WHERE request_key = ? AND step = ?`,
+		requestKey, step).Scan(&result)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return json.RawMessage(result), true, nil
+}
+
+// CompleteStep records the result of a completed step
+func (s *DeadLetterStore) CompleteStep(requestKey string, step string, result json.RawMessage) error {
+	_, err := s.db.Exec(`INSERT OR REPLACE INTO handler_steps (request_key, step, result, completed_at) VALUES (?, ?, ?, ?)`,
+		requestKey, step, string(result), time.Now().Unix())
+	return err
+}
+
+// ClearSteps forgets the checkpoints of a request that no longer needs them
+func (s *DeadLetterStore) ClearSteps(requestKey string) error {
+	_, err := s.db.Exec(`DELETE FROM handler_steps WHERE request_key = ?`, requestKey)
+	return err
+}
+
+// steps lists the completed steps of a request
+func (s *DeadLetterStore) steps(requestKey string) ([]HandlerStep, error) {
+	rows, err := s.db.Query(`SELECT step, result, completed_at FROM handler_steps WHERE request_key = ? ORDER BY completed_at, step`,
+		requestKey)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var steps []HandlerStep
+	for rows.Next() {
+		var step HandlerStep
+		var result string
+		var completedAt int64
+		if err := rows.Scan(&step.Step, &result, &completedAt); err != nil {
+			return nil, err
+		}
+		step.Result = json.RawMessage(result)
+		step.CompletedAt = time.Unix(completedAt, 0).UTC()
+		steps = append(steps, step)
+	}
+	return steps, rows.Err()
+}
+
+// RunStep runs one named handler step, or returns its stored result when a previous attempt
+// of the same request already completed it, so retries do not repeat side effects.
+// A failing step is remembered on the context for the dead letter.
+func RunStep[T any](ctx *MessageContext, step string, fn func() (T, error)) (T, error) {
+	var store *DeadLetterStore
+	if ctx.handler != nil {
+		store = ctx.handler.deadLetters
+	}
+	requestKey := logRequestID(ctx.Raw)
+
+	if store != nil {
+		if stored, ok, err := store.CompletedStep(requestKey, step); err != nil {
+			log.Printf("Error reading checkpoint %s of %s: %v", step, requestKey, err)
+		} else if ok {
+			var result T
+			if err := json.Unmarshal(stored, &result); err == nil {
+				ctx.Logf("Reusing result of completed step %s", step)
+				return result, nil
+			}
+		}
+	}
+
+	result, err := fn()
+	if err != nil {
+		ctx.failedStep = step
+		return result, err
+	}
+
+	if store != nil {
+		encoded, err := json.Marshal(result)
+		if err == nil {
+			err = store.CompleteStep(requestKey, step, encoded)
+		}
+		if err != nil {
+			log.Printf("Error storing checkpoint %s of %s: %v", step, requestKey, err)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,63 @@
+package handle
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// decodeEventData parses an eventData payload carried by the contract events.
+// Payloads may be plain JSON, "zlib:"-prefixed base64 zlib, or raw zlib bytes.
+func decodeEventData(data []byte) (map[string]interface{}, error) {
+	var eventData map[string]interface{}
+	if err := json.Unmarshal(data, &eventData); err == nil {
+		return eventData, nil
+	}
+
+	decompressed, err := inflateEventData(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(decompressed, &eventData); err != nil {
+		return nil, fmt.Errorf("failed to parse event data: %v", err)
+	}
+	return eventData, nil
+}
+
+// inflateEventData decompresses "zlib:"-prefixed base64 or raw zlib event data
+func inflateEventData(data []byte) ([]byte, error) {
+	if strings.HasPrefix(string(data), "zlib:") {
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(string(data), "zlib:"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode base64: %v", err)
+		}
+		data = decoded
+	}
+
+	zlibReader, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("event data is neither JSON nor zlib compressed: %v", err)
+	}
+	defer zlibReader.Close()
+
+	decompressed, err := io.ReadAll(zlibReader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress event data: %v", err)
+	}
+	return decompressed, nil
+}
+
+// eventDataType returns the "type" field of an eventData payload, or "" if it has none
+func eventDataType(data []byte) string {
+	eventData, err := decodeEventData(data)
+	if err != nil {
+		return ""
+	}
+	eventType, _ := eventData["type"].(string)
+	return eventType
+}
@@ -0,0 +1,583 @@
+package handle
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	contract "dappmeetingnew/constract"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// Contract event names stored by the indexer
+const (
+	EventNameParticipantJoined   = "ParticipantJoined"
+	EventNameParticipantLeft     = "ParticipantLeft"
+	EventNameTrackAdded          = "TrackAdded"
+	EventNameForwardedToBackend  = "EventForwardedToBackend"
+	EventNameForwardedToFrontend = "EventForwardedToFrontend"
+)
+
+// eventIndexerSchema creates the event index tables
+var eventIndexerSchema = []string{
+	`CREATE TABLE IF NOT EXISTS contract_events (
+		id           INTEGER PRIMARY KEY AUTOINCREMENT,
+		block_number INTEGER NOT NULL,
+		block_hash   TEXT    NOT NULL,
+		block_time   INTEGER NOT NULL,
+		tx_hash      TEXT    NOT NULL,
+		log_index    INTEGER NOT NULL,
+		event_name   TEXT    NOT NULL,
+		room_id      TEXT    NOT NULL,
+		wallet       TEXT    NOT NULL,
+		message_type TEXT    NOT NULL DEFAULT '',
+		track_name   TEXT    NOT NULL DEFAULT '',
+		session_id   TEXT    NOT NULL DEFAULT '',
+		event_data   BLOB,
+		decoded      TEXT    NOT NULL,
+		UNIQUE (tx_hash, log_index)
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_contract_events_room_time ON contract_events (room_id, block_time)`,
+	`CREATE INDEX IF NOT EXISTS idx_contract_events_wallet_time ON contract_events (wallet, block_time)`,
+	`CREATE INDEX IF NOT EXISTS idx_contract_events_block ON contract_events (block_number)`,
+	`CREATE TABLE IF NOT EXISTS contract_event_tracks (
+		event_id     INTEGER NOT NULL REFERENCES contract_events (id) ON DELETE CASCADE,
+		position     INTEGER NOT NULL,
+		track_name   TEXT    NOT NULL,
+		mid          TEXT    NOT NULL,
+		location     TEXT    NOT NULL,
+		is_published INTEGER NOT NULL,
+		session_id   TEXT    NOT NULL,
+		PRIMARY KEY (event_id, position)
+	)`,
+	`CREATE TABLE IF NOT EXISTS participant_names (
+		room_id    TEXT    NOT NULL,
+		wallet     TEXT    NOT NULL,
+		name       TEXT    NOT NULL,
+		updated_at INTEGER NOT NULL,
+		PRIMARY KEY (room_id, wallet)
+	)`,
+	`CREATE TABLE IF NOT EXISTS indexer_state (
+		key   TEXT PRIMARY KEY,
+		value TEXT NOT NULL
+	)`,
+}
+
+// IndexedEvent is a contract event stored in the index
+type IndexedEvent struct {
+	ID          int64           `json:"id"`
+	BlockNumber uint64          `json:"blockNumber"`
+	BlockHash   string          `json:"blockHash"`
+	BlockTime   time.Time       `json:"blockTime"`
+	TxHash      string          `json:"txHash"`
+	LogIndex    uint            `json:"logIndex"`
+	EventName   string          `json:"eventName"`
+	RoomID      string          `json:"roomId"`
+	Wallet      string          `json:"wallet"`
+	MessageType string          `json:"messageType,omitempty"`
+	TrackName   string          `json:"trackName,omitempty"`
+	SessionID   string          `json:"sessionId,omitempty"`
+	Decoded     json.RawMessage `json:"decoded"`
+
+	eventData []byte
+	tracks    []contract.DAppMeetingTrack
+}
+
+// EventQuery filters indexed events; empty fields match everything
+type EventQuery struct {
+	RoomID     string
+	Wallet     string
+	EventNames []string
+	From       time.Time
+	To         time.Time
+	Limit      int
+}
+
+// EventIndexer writes every contract event into the local SQLite database
+type EventIndexer struct {
+	db               *sql.DB
+	client           *ethclient.Client
+	contractInstance *contract.Contract
+	blockTimes       map[uint64]time.Time
+	mu               sync.Mutex
+}
+
+// NewEventIndexer creates the index schema and returns an indexer
+func NewEventIndexer(db *sql.DB, client *ethclient.Client, contractInstance *contract.Contract) (*EventIndexer, error) {
+	if err := migrate(db, eventIndexerSchema); err != nil {
+		return nil, err
+	}
+	return &EventIndexer{
+		db:               db,
+		client:           client,
+		contractInstance: contractInstance,
+		blockTimes:       make(map[uint64]time.Time),
+	}, nil
+}
+
+// IndexParticipantJoined stores a ParticipantJoined event
+func (ix *EventIndexer) IndexParticipantJoined(event *contract.ContractParticipantJoined) error {
+	if err := ix.store(ix.fromParticipantJoined(event)); err != nil {
+		return err
+	}
+	ix.recordParticipantName(event)
+	return nil
+}
+
+// IndexParticipantLeft stores a ParticipantLeft event
+func (ix *EventIndexer) IndexParticipantLeft(event *contract.ContractParticipantLeft) error {
+	return ix.store(ix.fromParticipantLeft(event))
+}
+
+// IndexTrackAdded stores a TrackAdded event
+func (ix *EventIndexer) IndexTrackAdded(event *contract.ContractTrackAdded) error {
+	return ix.store(ix.fromTrackAdded(event))
+}
+
+// IndexEventToBackend stores an EventForwardedToBackend event
+func (ix *EventIndexer) IndexEventToBackend(event *contract.ContractEventForwardedToBackend) error {
+	return ix.store(ix.fromEventToBackend(event))
+}
+
+// IndexEventToFrontend stores an EventForwardedToFrontend event
+func (ix *EventIndexer) IndexEventToFrontend(event *contract.ContractEventForwardedToFrontend) error {
+	return ix.store(ix.fromEventToFrontend(event))
+}
+
+// fromParticipantJoined converts a ParticipantJoined event
+func (ix *EventIndexer) fromParticipantJoined(event *contract.ContractParticipantJoined) (*IndexedEvent, types.Log) {
+	decoded := map[string]interface{}{
+		"roomId":             event.RoomId,
+		"participant":        event.Participant.Hex(),
+		"initialTracks":      toAPITracks(event.InitialTracks),
+		"sessionDescription": string(event.SessionDescription),
+	}
+	indexed := newIndexedEvent(EventNameParticipantJoined, event.RoomId, event.Participant.Hex(), decoded)
+	indexed.tracks = event.InitialTracks
+	return indexed, event.Raw
+}
+
+// fromParticipantLeft converts a ParticipantLeft event
+func (ix *EventIndexer) fromParticipantLeft(event *contract.ContractParticipantLeft) (*IndexedEvent, types.Log) {
+	decoded := map[string]interface{}{
+		"roomId":      event.RoomId,
+		"participant": event.Participant.Hex(),
+	}
+	return newIndexedEvent(EventNameParticipantLeft, event.RoomId, event.Participant.Hex(), decoded), event.Raw
+}
+
+// fromTrackAdded converts a TrackAdded event
+func (ix *EventIndexer) fromTrackAdded(event *contract.ContractTrackAdded) (*IndexedEvent, types.Log) {
+	decoded := map[string]interface{}{
+		"roomId":      event.RoomId,
+		"participant": event.Participant.Hex(),
+		"trackName":   event.TrackName,
+		"sessionId":   event.SessionId,
+	}
+	indexed := newIndexedEvent(EventNameTrackAdded, event.RoomId, event.Participant.Hex(), decoded)
+	indexed.TrackName = event.TrackName
+	indexed.SessionID = event.SessionId
+	return indexed, event.Raw
+}
+
+// fromEventToBackend converts an EventForwardedToBackend event
+func (ix *EventIndexer) fromEventToBackend(event *contract.ContractEventForwardedToBackend) (*IndexedEvent, types.Log) {
+	decoded := map[string]interface{}{
+		"roomId": event.RoomId,
+		"sender": event.Sender.Hex(),
+	}
+	indexed := newIndexedEvent(EventNameForwardedToBackend, event.RoomId, event.Sender.Hex(), decoded)
+	indexed.setEventData(decoded, event.EventData)
+	return indexed, event.Raw
+}
+
+// fromEventToFrontend converts an EventForwardedToFrontend event
+func (ix *EventIndexer) fromEventToFrontend(event *contract.ContractEventForwardedToFrontend) (*IndexedEvent, types.Log) {
+	decoded := map[string]interface{}{
+		"roomId":      event.RoomId,
+		"participant": event.Participant.Hex(),
+	}
+	indexed := newIndexedEvent(EventNameForwardedToFrontend, event.RoomId, event.Participant.Hex(), decoded)
+	indexed.setEventData(decoded, event.EventData)
+	return indexed, event.Raw
+}
+
+// newIndexedEvent creates an indexed event with its decoded JSON
+func newIndexedEvent(eventName string, roomID string, wallet string, decoded map[string]interface{}) *IndexedEvent {
+	return &IndexedEvent{
+		EventName: eventName,
+		RoomID:    roomID,
+		Wallet:    wallet,
+		Decoded:   mustMarshal(decoded),
+	}
+}
+
+// setEventData attaches the raw eventData and its decoded payload
+func (e *IndexedEvent) setEventData(decoded map[string]interface{}, eventData []byte) {
+	e.eventData = eventData
+	if payload, err := decodeEventData(eventData); err == nil {
+		decoded["eventData"] = payload
+		e.MessageType, _ = payload["type"].(string)
+		if sessionID, ok := payload["sessionId"].(string); ok {
+			e.SessionID = sessionID
+		} else if sessionID, ok := payload["sessionID"].(string); ok {
+			e.SessionID = sessionID
+		}
+		if trackName, ok := payload["trackName"].(string); ok {
+			e.TrackName = trackName
+		}
+	} else {
+		decoded["eventDataError"] = err.Error()
+	}
+	e.Decoded = mustMarshal(decoded)
+}
+
+// mustMarshal marshals values that are known to be JSON-safe
+func mustMarshal(value interface{}) json.RawMessage {
+	data, err := json.Marshal(value)
+	if err != nil {
+		data, _ = json.Marshal(map[string]string{"marshalError": err.Error()})
+	}
+	return data
+}
+
+// store writes an event, or deletes it when the log was removed by a reorg
+func (ix *EventIndexer) store(event *IndexedEvent, raw types.Log) error {
+	if raw.Removed {
+		_, err := ix.db.Exec(`DELETE FROM contract_events WHERE tx_hash = ? AND log_index = ?`,
+			raw.TxHash.Hex(), raw.Index)
+		return err
+	}
+
+	blockTime, err := ix.BlockTime(raw.BlockNumber)
+	if err != nil {
+		return err
+	}
+
+	tx, err := ix.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := insertIndexedEvent(tx, event, raw, blockTime); err != nil {
+		return err
+	}
+	if err := setIndexerState(tx, "last_block", raw.BlockNumber); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// insertIndexedEvent inserts one event and its tracks, ignoring events that are already indexed
+func insertIndexedEvent(tx *sql.Tx, event *IndexedEvent, raw types.Log, blockTime time.Time) error {
+	result, err := tx.Exec(`INSERT OR IGNORE INTO contract_events
+		(block_number, block_hash, block_time, tx_hash, log_index, event_name, room_id, wallet,
+		 message_type, track_name, session_id, event_data, decoded)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		raw.BlockNumber, raw.BlockHash.Hex(), blockTime.Unix(), raw.TxHash.Hex(), raw.Index,
+		event.EventName, event.RoomID, event.Wallet, event.MessageType, event.TrackName, event.SessionID,
+		event.eventData, string(event.Decoded))
+	if err != nil {
+		return fmt.Errorf("failed to insert event: %v", err)
+	}
+
+	inserted, err := result.RowsAffected()
+	if err != nil || inserted == 0 {
+		return err
+	}
+	eventID, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	for i, track := range event.tracks {
+		_, err := tx.Exec(`INSERT INTO contract_event_tracks
+			(event_id, position, track_name, mid, location, is_published, session_id)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			eventID, i, track.TrackName, track.Mid, track.Location, track.IsPublished, track.SessionId)
+		if err != nil {
+			return fmt.Errorf("failed to insert event track: %v", err)
+		}
+	}
+	return nil
+}
+
+// setIndexerState advances the last indexed block
+func setIndexerState(tx *sql.Tx, key string, blockNumber uint64) error {
+	_, err := tx.Exec(`INSERT INTO indexer_state (key, value) VALUES (?, ?)
+		ON CONFLICT (key) DO UPDATE SET value = excluded.value
+		WHERE CAST(excluded.value AS INTEGER) > CAST(indexer_state.value AS INTEGER)`,
+		key, fmt.Sprint(blockNumber))
+	return err
+}
+
+// LastIndexedBlock returns the highest block the indexer has stored an event from
+func (ix *EventIndexer) LastIndexedBlock() (uint64, error) {
+	var value string
+	err := ix.db.QueryRow(`SELECT value FROM indexer_state WHERE key = 'last_block'`).Scan(&value)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	var blockNumber uint64
+	_, err = fmt.Sscan(value, &blockNumber)
+	return blockNumber, err
+}
+
+// BlockTime returns the timestamp of a block, caching recent lookups
+func (ix *EventIndexer) BlockTime(blockNumber uint64) (time.Time, error) {
+	ix.mu.Lock()
+	if t, ok := ix.blockTimes[blockNumber]; ok {
+		ix.mu.Unlock()
+		return t, nil
+	}
+	ix.mu.Unlock()
+
+	header, err := ix.client.HeaderByNumber(context.Background(), new(big.Int).SetUint64(blockNumber))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read block %d: %v", blockNumber, err)
+	}
+	t := time.Unix(int64(header.Time), 0).UTC()
+
+	ix.mu.Lock()
+	if len(ix.blockTimes) > 1024 {
+		ix.blockTimes = make(map[uint64]time.Time)
+	}
+	ix.blockTimes[blockNumber] = t
+	ix.mu.Unlock()
+	return t, nil
+}
+
+// reindexChunkSize bounds the block range of a single log query
+const reindexChunkSize = 5000
+
+// Reindex deletes and re-reads every contract event in the block range [from, to]
+func (ix *EventIndexer) Reindex(ctx context.Context, from uint64, to uint64) (int, error) {
+	if to < from {
+		return 0, fmt.Errorf("invalid block range %d-%d", from, to)
+	}
+
+	total := 0
+	for start := from; start <= to; start += reindexChunkSize {
+		end := start + reindexChunkSize - 1
+		if end > to {
+			end = to
+		}
+		count, err := ix.reindexRange(ctx, start, end)
+		if err != nil {
+			return total, err
+		}
+		total += count
+	}
+	return total, nil
+}
+
+// reindexRange replaces the indexed events of one block range in a single transaction
+func (ix *EventIndexer) reindexRange(ctx context.Context, from uint64, to uint64) (int, error) {
+	type pending struct {
+		event *IndexedEvent
+		raw   types.Log
+	}
+	var events []pending
+	opts := &bind.FilterOpts{Start: from, End: &to, Context: ctx}
+
+	joined, err := ix.contractInstance.FilterParticipantJoined(opts)
+	if err != nil {
+		return 0, fmt.Errorf("failed to filter ParticipantJoined: %v", err)
+	}
+	var joinedParticipants []*contract.ContractParticipantJoined
+	for joined.Next() {
+		event, raw := ix.fromParticipantJoined(joined.Event)
+		events = append(events, pending{event, raw})
+		joinedParticipants = append(joinedParticipants, joined.Event)
+	}
+	if err := closeIterator(joined.Error(), joined.Close()); err != nil {
+		return 0, err
+	}
+
+	left, err := ix.contractInstance.FilterParticipantLeft(opts)
+	if err != nil {
+		return 0, fmt.Errorf("failed to filter ParticipantLeft: %v", err)
+	}
+	for left.Next() {
+		event, raw := ix.fromParticipantLeft(left.Event)
+		events = append(events, pending{event, raw})
+	}
+	if err := closeIterator(left.Error(), left.Close()); err != nil {
+		return 0, err
+	}
+
+	tracks, err := ix.contractInstance.FilterTrackAdded(opts)
+	if err != nil {
+		return 0, fmt.Errorf("failed to filter TrackAdded: %v", err)
+	}
+	for tracks.Next() {
+		event, raw := ix.fromTrackAdded(tracks.Event)
+		events = append(events, pending{event, raw})
+	}
+	if err := closeIterator(tracks.Error(), tracks.Close()); err != nil {
+		return 0, err
+	}
+
+	toBackend, err := ix.contractInstance.FilterEventForwardedToBackend(opts)
+	if err != nil {
+		return 0, fmt.Errorf("failed to filter EventForwardedToBackend: %v", err)
+	}
+	for toBackend.Next() {
+		event, raw := ix.fromEventToBackend(toBackend.Event)
+		events = append(events, pending{event, raw})
+	}
+	if err := closeIterator(toBackend.Error(), toBackend.Close()); err != nil {
+		return 0, err
+	}
+
+	toFrontend, err := ix.contractInstance.FilterEventForwardedToFrontend(opts)
+	if err != nil {
+		return 0, fmt.Errorf("failed to filter EventForwardedToFrontend: %v", err)
+	}
+	for toFrontend.Next() {
+		event, raw := ix.fromEventToFrontend(toFrontend.Event)
+		events = append(events, pending{event, raw})
+	}
+	if err := closeIterator(toFrontend.Error(), toFrontend.Close()); err != nil {
+		return 0, err
+	}
+
+	// Resolve block timestamps before opening the write transaction
+	blockTimes := make(map[uint64]time.Time)
+	for _, p := range events {
+		if _, ok := blockTimes[p.raw.BlockNumber]; ok {
+			continue
+		}
+		t, err := ix.BlockTime(p.raw.BlockNumber)
+		if err != nil {
+			return 0, err
+		}
+		blockTimes[p.raw.BlockNumber] = t
+	}
+
+	tx, err := ix.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM contract_events WHERE block_number BETWEEN ? AND ?`, from, to); err != nil {
+		return 0, fmt.Errorf("failed to clear block range: %v", err)
+	}
+	for _, p := range events {
+		if err := insertIndexedEvent(tx, p.event, p.raw, blockTimes[p.raw.BlockNumber]); err != nil {
+			return 0, err
+		}
+	}
+	if err := setIndexerState(tx, "last_block", to); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	for _, event := range joinedParticipants {
+		ix.recordParticipantName(event)
+	}
+
+	log.Printf("[Indexer] Reindexed %d events in blocks %d-%d", len(events), from, to)
+	return len(events), nil
+}
+
+// CatchUp indexes the blocks between the last indexed block and head
+func (ix *EventIndexer) CatchUp(ctx context.Context, head uint64) error {
+	last, err := ix.LastIndexedBlock()
+	if err != nil {
+		return err
+	}
+	// Nothing indexed yet: start from head rather than scanning the whole chain
+	if last == 0 || last >= head {
+		return nil
+	}
+	_, err = ix.Reindex(ctx, last+1, head)
+	return err
+}
+
+// closeIterator combines the iteration and close errors of a filter iterator
+func closeIterator(iterErr error, closeErr error) error {
+	if iterErr != nil {
+		return fmt.Errorf("failed to read logs: %v", iterErr)
+	}
+	return closeErr
+}
+
+// Query returns indexed events matching the query, oldest first
+func (ix *EventIndexer) Query(query EventQuery) ([]IndexedEvent, error) {
+	var conditions []string
+	var args []interface{}
+
+	if query.RoomID != "" {
+		conditions = append(conditions, "room_id = ?")
+		args = append(args, query.RoomID)
+	}
+	if query.Wallet != "" {
+		conditions = append(conditions, "wallet = ?")
+		args = append(args, common.HexToAddress(query.Wallet).Hex())
+	}
+	if len(query.EventNames) > 0 {
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(query.EventNames)), ",")
+		conditions = append(conditions, "event_name IN ("+placeholders+")")
+		for _, name := range query.EventNames {
+			args = append(args, name)
+		}
+	}
+	if !query.From.IsZero() {
+		conditions = append(conditions, "block_time >= ?")
+		args = append(args, query.From.Unix())
+	}
+	if !query.To.IsZero() {
+		conditions = append(conditions, "block_time < ?")
+		args = append(args, query.To.Unix())
+	}
+
+	statement := `SELECT id, block_number, block_hash, block_time, tx_hash, log_index, event_name,
+		room_id, wallet, message_type, track_name, session_id, decoded FROM contract_events`
+	if len(conditions) > 0 {
+		statement += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	statement += " ORDER BY block_number, log_index"
+	if query.Limit > 0 {
+		statement += fmt.Sprintf(" LIMIT %d", query.Limit)
+	}
+
+	rows, err := ix.db.Query(statement, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query events: %v", err)
+	}
+	defer rows.Close()
+
+	var events []IndexedEvent
+	for rows.Next() {
+		var event IndexedEvent
+		var blockTime int64
+		var decoded string
+		if err := rows.Scan(&event.ID, &event.BlockNumber, &event.BlockHash, &blockTime, &event.TxHash,
+			&event.LogIndex, &event.EventName, &event.RoomID, &event.Wallet, &event.MessageType,
+			&event.TrackName, &event.SessionID, &decoded); err != nil {
+			return nil, fmt.Errorf("failed to read event: %v", err)
+		}
+		event.BlockTime = time.Unix(blockTime, 0).UTC()
+		event.Decoded = json.RawMessage(decoded)
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
@@ -0,0 +1,217 @@
+package handle
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	contract "dappmeetingnew/constract"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Kinds of records published to event sinks
+const (
+	SinkKindContractEvent  = "contract-event"
+	SinkKindHandlerOutcome = "handler-outcome"
+	SinkKindMeetingEnded   = "meeting-ended"
+)
+
+// EventSink receives the stream of decoded contract events and handler outcomes
+type EventSink interface {
+	Publish(record SinkRecord) error
+	Close() error
+}
+
+// SinkRecord is one decoded contract event or the outcome of handling it
+type SinkRecord struct {
+	Kind        string       `json:"kind"`
+	EventName   string       `json:"eventName"`
+	RoomID      string       `json:"roomId"`
+	Wallet      string       `json:"wallet"`
+	BlockNumber uint64       `json:"blockNumber"`
+	TxHash      string       `json:"txHash"`
+	LogIndex    uint         `json:"logIndex"`
+	Removed     bool         `json:"removed,omitempty"`
+	RecordedAt  time.Time    `json:"recordedAt"`
+	Data        interface{}  `json:"data,omitempty"`
+	Outcome     *SinkOutcome `json:"outcome,omitempty"`
+}
+
+// SinkOutcome describes how the backend handled an event
+type SinkOutcome struct {
+	Success    bool   `json:"success"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"durationMs"`
+}
+
+// NewContractEventRecord builds a sink record from a decoded contract event
+func NewContractEventRecord(event interface{}) SinkRecord {
+	record := SinkRecord{Kind: SinkKindContractEvent, RecordedAt: time.Now().UTC()}
+
+	var raw types.Log
+	switch e := event.(type) {
+	case *contract.ContractParticipantJoined:
+		record.EventName, record.RoomID, record.Wallet, raw = EventNameParticipantJoined, e.RoomId, e.Participant.Hex(), e.Raw
+		record.Data = map[string]interface{}{
+			"initialTracks":      e.InitialTracks,
+			"sessionDescription": e.SessionDescription,
+		}
+	case *contract.ContractParticipantLeft:
+		record.EventName, record.RoomID, record.Wallet, raw = EventNameParticipantLeft, e.RoomId, e.Participant.Hex(), e.Raw
+	case *contract.ContractTrackAdded:
+		record.EventName, record.RoomID, record.Wallet, raw = EventNameTrackAdded, e.RoomId, e.Participant.Hex(), e.Raw
+		record.Data = map[string]interface{}{
+			"trackName": e.TrackName,
+			"sessionId": e.SessionId,
+		}
+	case *contract.ContractEventForwardedToBackend:
+		record.EventName, record.RoomID, record.Wallet, raw = EventNameForwardedToBackend, e.RoomId, e.Sender.Hex(), e.Raw
+		record.Data = sinkEventData(e.EventData)
+	case *contract.ContractEventForwardedToFrontend:
+		record.EventName, record.RoomID, record.Wallet, raw = EventNameForwardedToFrontend, e.RoomId, e.Participant.Hex(), e.Raw
+		record.Data = sinkEventData(e.EventData)
+	}
+
+	record.BlockNumber = raw.BlockNumber
+	record.TxHash = raw.TxHash.Hex()
+	record.LogIndex = raw.Index
+	record.Removed = raw.Removed
+	return record
+}
+
+// NewHandlerOutcomeRecord builds a sink record describing how an event was handled
+func NewHandlerOutcomeRecord(event interface{}, err error, duration time.Duration) SinkRecord {
+	record := NewContractEventRecord(event)
+	record.Kind = SinkKindHandlerOutcome
+	record.Data = nil
+	record.Outcome = &SinkOutcome{Success: err == nil, DurationMs: duration.Milliseconds()}
+	if err != nil {
+		record.Outcome.Error = err.Error()
+	}
+	return record
+}
+
+// NewMeetingEndedRecord builds a sink record for an ended meeting
+func NewMeetingEndedRecord(meeting MeetingRecord) SinkRecord {
+	return SinkRecord{
+		Kind:       SinkKindMeetingEnded,
+		EventName:  "MeetingEnded",
+		RoomID:     meeting.RoomID,
+		RecordedAt: time.Now().UTC(),
+		Data:       meeting,
+	}
+}
+
+// sinkEventData decodes a forwarded payload, keeping the decoding error when it is not readable
+func sinkEventData(data []byte) interface{} {
+	decoded, err := decodeEventData(data)
+	if err != nil {
+		return map[string]interface{}{"decodeError": err.Error(), "size": len(data)}
+	}
+	return decoded
+}
+
+// SinkGroup publishes every record to a set of sinks, logging sink failures
+type SinkGroup struct {
+	sinks []EventSink
+}
+
+// NewSinkGroup creates a group of sinks
+func NewSinkGroup(sinks ...EventSink) *SinkGroup {
+	return &SinkGroup{sinks: sinks}
+}
+
+// Add attaches another sink to the group
+func (g *SinkGroup) Add(sink EventSink) {
+	g.sinks = append(g.sinks, sink)
+}
+
+// Len returns the number of sinks in the group
+func (g *SinkGroup) Len() int {
+	return len(g.sinks)
+}
+
+// Publish sends the record to every sink
+func (g *SinkGroup) Publish(record SinkRecord) {
+	for _, sink := range g.sinks {
+		if err := sink.Publish(record); err != nil {
+			log.Printf("[Sink] Error publishing %s %s: %v", record.Kind, record.EventName, err)
+		}
+	}
+}
+
+// Close closes every sink
+func (g *SinkGroup) Close() error {
+	var firstErr error
+	for _, sink := range g.sinks {
+		if err := sink.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// OpenEventSink creates a sink from a spec: "stdout", "jsonl:<path>", "unix:<socket path>" or
+// "broker:<name>[:<topic prefix>]" for a broker registered with RegisterMessageBroker, such as "local".
+// JSON Lines files rotate once they reach maxBytes, keeping maxFiles rotated files.
+func OpenEventSink(spec string, maxBytes int64, maxFiles int) (EventSink, error) {
+	kind, target, _ := strings.Cut(spec, ":")
+	switch kind {
+	case "stdout":
+		return NewWriterSink(os.Stdout), nil
+	case "jsonl":
+		if target == "" {
+			return nil, fmt.Errorf("jsonl sink needs a file path")
+		}
+		return NewJSONLSink(target, maxBytes, maxFiles)
+	case "unix":
+		if target == "" {
+			return nil, fmt.Errorf("unix sink needs a socket path")
+		}
+		return NewUnixSocketSink(target)
+	case "broker":
+		name, topicPrefix, _ := strings.Cut(target, ":")
+		broker, ok := lookupMessageBroker(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown message broker: %q", name)
+		}
+		return NewBrokerSink(broker, topicPrefix), nil
+	default:
+		return nil, fmt.Errorf("unknown event sink: %s", spec)
+	}
+}
+
+// WriterSink writes records as JSON Lines to a writer such as stdout
+type WriterSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriterSink creates a sink writing to w
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{w: w}
+}
+
+// Publish writes one JSON line
+func (s *WriterSink) Publish(record SinkRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("error marshaling sink record: %v", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(append(line, '\n'))
+	return err
+}
+
+// Close does nothing, the writer belongs to the caller
+func (s *WriterSink) Close() error {
+	return nil
+}
@@ -0,0 +1,109 @@
+package handle
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	contract "dappmeetingnew/constract"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// receiveRecord reads one record delivered to a broker subscription
+func receiveRecord(t *testing.T, ch <-chan []byte) SinkRecord {
+	t.Helper()
+	select {
+	case payload, ok := <-ch:
+		if !ok {
+			t.Fatal("subscription closed before a record was delivered")
+		}
+		var record SinkRecord
+		if err := json.Unmarshal(payload, &record); err != nil {
+			t.Fatalf("delivered payload is not a sink record: %v", err)
+		}
+		return record
+	case <-time.After(time.Second):
+		t.Fatal("no record delivered")
+	}
+	return SinkRecord{}
+}
+
+func TestOpenEventSinkPublishesThroughLocalBroker(t *testing.T) {
+	broker := NewLocalBroker()
+	RegisterMessageBroker("test-local", broker)
+
+	sink, err := OpenEventSink("broker:test-local:meet", 0, 0)
+	if err != nil {
+		t.Fatalf("OpenEventSink: %v", err)
+	}
+	if _, ok := sink.(*BrokerSink); !ok {
+		t.Fatalf("OpenEventSink returned %T, want *BrokerSink", sink)
+	}
+
+	joined := broker.Subscribe("meet.contract-event.ParticipantJoined", 1)
+	ended := broker.Subscribe("meet.meeting-ended.MeetingEnded", 1)
+
+	participant := common.HexToAddress("0x00000000000000000000000000000000000000a1")
+	txHash := common.HexToHash("0x01")
+	event := &contract.ContractParticipantJoined{
+		RoomId:      "room-1",
+		Participant: participant,
+		Raw:         types.Log{BlockNumber: 42, TxHash: txHash, Index: 3},
+	}
+	if err := sink.Publish(NewContractEventRecord(event)); err != nil {
+		t.Fatalf("Publish contract event: %v", err)
+	}
+	if err := sink.Publish(NewMeetingEndedRecord(MeetingRecord{ID: 7, RoomID: "room-1"})); err != nil {
+		t.Fatalf("Publish meeting ended: %v", err)
+	}
+
+	record := receiveRecord(t, joined)
+	if record.Kind != SinkKindContractEvent || record.EventName != EventNameParticipantJoined {
+		t.Errorf("got %s %s, want %s %s", record.Kind, record.EventName, SinkKindContractEvent, EventNameParticipantJoined)
+	}
+	if record.RoomID != "room-1" || record.Wallet != participant.Hex() {
+		t.Errorf("got room %s wallet %s, want room-1 %s", record.RoomID, record.Wallet, participant.Hex())
+	}
+	if record.BlockNumber != 42 || record.TxHash != txHash.Hex() || record.LogIndex != 3 {
+		t.Errorf("got block %d tx %s index %d, want 42 %s 3", record.BlockNumber, record.TxHash, record.LogIndex, txHash.Hex())
+	}
+
+	record = receiveRecord(t, ended)
+	if record.Kind != SinkKindMeetingEnded || record.RoomID != "room-1" {
+		t.Errorf("got %s for room %s, want %s for room-1", record.Kind, record.RoomID, SinkKindMeetingEnded)
+	}
+
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if _, ok := <-joined; ok {
+		t.Error("subscription still open after the sink was closed")
+	}
+}
+
+func TestOpenEventSinkBrokerDefaultsTopicPrefix(t *testing.T) {
+	broker := NewLocalBroker()
+	RegisterMessageBroker("test-prefix", broker)
+
+	sink, err := OpenEventSink("broker:test-prefix", 0, 0)
+	if err != nil {
+		t.Fatalf("OpenEventSink: %v", err)
+	}
+	defer sink.Close()
+
+	ended := broker.Subscribe("meeting.meeting-ended.MeetingEnded", 1)
+	if err := sink.Publish(NewMeetingEndedRecord(MeetingRecord{RoomID: "room-2"})); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if record := receiveRecord(t, ended); record.RoomID != "room-2" {
+		t.Errorf("got room %s, want room-2", record.RoomID)
+	}
+}
+
+func TestOpenEventSinkUnknownBroker(t *testing.T) {
+	if _, err := OpenEventSink("broker:missing", 0, 0); err == nil {
+		t.Fatal("OpenEventSink accepted an unregistered broker")
+	}
+}
@@ -0,0 +1,220 @@
+package handle
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// GasLedgerEntry records the cost of one mined backend transaction. Its timestamp is the time the
+// backend received the receipt, which saves a block header lookup per transaction.
+type GasLedgerEntry struct {
+	TxHash            string    `json:"txHash"`
+	BlockNumber       uint64    `json:"blockNumber"`
+	Timestamp         time.Time `json:"timestamp"`
+	Method            string    `json:"method"`
+	EventType         string    `json:"eventType"`
+	RoomID            string    `json:"roomId"`
+	Participant       string    `json:"participant"`
+	GasUsed           uint64    `json:"gasUsed"`
+	EffectiveGasPrice string    `json:"effectiveGasPrice"` // wei
+	CostWei           string    `json:"costWei"`
+	Reverted          bool      `json:"reverted"`
+}
+
+// GasLedger stores gas ledger entries in the shared database
+type GasLedger struct {
+	db *sql.DB
+}
+
+// GasReportRow aggregates ledger entries sharing the same grouping key
+type GasReportRow struct {
+	RoomID       string `json:"roomId,omitempty"`
+	Participant  string `json:"participant,omitempty"`
+	EventType    string `json:"eventType,omitempty"`
+	Day          string `json:"day,omitempty"`
+	Transactions int    `json:"transactions"`
+	GasUsed      uint64 `json:"gasUsed"`
+	CostWei      string `json:"costWei"`
+}
+
+// Grouping dimensions accepted by BuildGasReport
+const (
+	GasGroupRoom        = "room"
+	GasGroupParticipant = "participant"
+	GasGroupEventType   = "type"
+	GasGroupDay         = "day"
+)
+
+// gasLedgerSchema creates the gas ledger table
+var gasLedgerSchema = []string{
+	`CREATE TABLE IF NOT EXISTS gas_ledger (
+		tx_hash             TEXT    PRIMARY KEY,
+		block_number        INTEGER NOT NULL,
+		recorded_at            INTEGER NOT NULL,
+		method              TEXT    NOT NULL,
+		event_type          TEXT    NOT NULL,
+		room_id             TEXT    NOT NULL,
+		participant         TEXT    NOT NULL,
+		gas_used            INTEGER NOT NULL,
+		effective_gas_price TEXT    NOT NULL,
+		cost_wei            TEXT    NOT NULL,
+		reverted            INTEGER NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_gas_ledger_recorded_at ON gas_ledger (recorded_at)`,
+}
+
+// NewGasLedger creates the ledger on the shared database
+func NewGasLedger(db *sql.DB) (*GasLedger, error) {
+	if err := migrate(db, gasLedgerSchema); err != nil {
+		return nil, err
+	}
+	return &GasLedger{db: db}, nil
+}
+
+// Record stores an entry; an entry already stored for the same transaction is kept
+func (l *GasLedger) Record(entry GasLedgerEntry) error {
+	_, err := l.db.Exec(`INSERT OR IGNORE INTO gas_ledger (tx_hash, block_number, recorded_at, method, event_type, room_id,
+		participant, gas_used, effective_gas_price, cost_wei, reverted) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		entry.TxHash, entry.BlockNumber, entry.Timestamp.UnixMilli(), entry.Method, entry.EventType, entry.RoomID,
+		entry.Participant, entry.GasUsed, entry.EffectiveGasPrice, entry.CostWei, entry.Reverted)
+	if err != nil {
+		return fmt.Errorf("error storing gas ledger entry: %v", err)
+	}
+	return nil
+}
+
+// Entries reads the ledger entries recorded within [from, to); zero times are unbounded
+func (l *GasLedger) Entries(from, to time.Time) ([]GasLedgerEntry, error) {
+	query := `SELECT tx_hash, block_number, recorded_at, method, event_type, room_id, participant, gas_used,
+		effective_gas_price, cost_wei, reverted FROM gas_ledger WHERE 1 = 1`
+	var args []interface{}
+	if !from.IsZero() {
+		query += ` AND recorded_at >= ?`
+		args = append(args, from.UnixMilli())
+	}
+	if !to.IsZero() {
+		query += ` AND recorded_at < ?`
+		args = append(args, to.UnixMilli())
+	}
+	query += ` ORDER BY recorded_at, tx_hash`
+
+	rows, err := l.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error reading gas ledger: %v", err)
+	}
+	defer rows.Close()
+
+	var entries []GasLedgerEntry
+	for rows.Next() {
+		var entry GasLedgerEntry
+		var recordedAt int64
+		if err := rows.Scan(&entry.TxHash, &entry.BlockNumber, &recordedAt, &entry.Method, &entry.EventType, &entry.RoomID,
+			&entry.Participant, &entry.GasUsed, &entry.EffectiveGasPrice, &entry.CostWei, &entry.Reverted); err != nil {
+			return nil, fmt.Errorf("error reading gas ledger: %v", err)
+		}
+		entry.Timestamp = time.UnixMilli(recordedAt).UTC()
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading gas ledger: %v", err)
+	}
+	return entries, nil
+}
+
+// BuildGasReport aggregates entries by the given dimensions (room, participant, type, day)
+func BuildGasReport(entries []GasLedgerEntry, groupBy []string) ([]GasReportRow, error) {
+	for _, dim := range groupBy {
+		switch dim {
+		case GasGroupRoom, GasGroupParticipant, GasGroupEventType, GasGroupDay:
+		default:
+			return nil, fmt.Errorf("unknown grouping: %s", dim)
+		}
+	}
+
+	type aggregate struct {
+		row  GasReportRow
+		cost *big.Int
+	}
+	groups := make(map[GasReportRow]*aggregate)
+
+	for _, entry := range entries {
+		var key GasReportRow
+		for _, dim := range groupBy {
+			switch dim {
+			case GasGroupRoom:
+				key.RoomID = entry.RoomID
+			case GasGroupParticipant:
+				key.Participant = entry.Participant
+			case GasGroupEventType:
+				key.EventType = entry.EventType
+			case GasGroupDay:
+				key.Day = entry.Timestamp.UTC().Format("2006-01-02")
+			}
+		}
+
+		agg, ok := groups[key]
+		if !ok {
+			agg = &aggregate{row: key, cost: new(big.Int)}
+			groups[key] = agg
+		}
+		agg.row.Transactions++
+		agg.row.GasUsed += entry.GasUsed
+		if cost, ok := new(big.Int).SetString(entry.CostWei, 10); ok {
+			agg.cost.Add(agg.cost, cost)
+		}
+	}
+
+	rows := make([]GasReportRow, 0, len(groups))
+	for _, agg := range groups {
+		agg.row.CostWei = agg.cost.String()
+		rows = append(rows, agg.row)
+	}
+
+	sort.Slice(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		if a.Day != b.Day {
+			return a.Day < b.Day
+		}
+		if a.RoomID != b.RoomID {
+			return a.RoomID < b.RoomID
+		}
+		if a.Participant != b.Participant {
+			return a.Participant < b.Participant
+		}
+		return a.EventType < b.EventType
+	})
+	return rows, nil
+}
+
+// WriteGasReportCSV writes report rows as CSV with a header line
+func WriteGasReportCSV(w io.Writer, rows []GasReportRow) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"day", "room_id", "participant", "event_type", "transactions", "gas_used", "cost_wei"})
+	for _, row := range rows {
+		writer.Write([]string{
+			row.Day,
+			row.RoomID,
+			row.Participant,
+			row.EventType,
+			strconv.Itoa(row.Transactions),
+			strconv.FormatUint(row.GasUsed, 10),
+			row.CostWei,
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// WriteGasReportJSON writes report rows as an indented JSON array
+func WriteGasReportJSON(w io.Writer, rows []GasReportRow) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(rows)
+}
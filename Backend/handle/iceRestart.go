@@ -0,0 +1,154 @@
+package handle
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// handleIceRestart renegotiates the sender's session with an ICE-restart offer. When Cloudflare
+// no longer knows the session, a new one is created and the old session's tracks are republished.
+func (h *EventHandler) handleIceRestart(ctx *MessageContext, request IceRestartRequest) error {
+	sessionID := request.SessionID
+	if sessionID == "" {
+		var err error
+		if sessionID, err = h.contractSession(ctx); err != nil {
+			return err
+		}
+	}
+	ctx.Logf("Handling ICE restart of session %s for %s", sessionID, ctx.Sender.Hex())
+
+	if err := h.verifySession(ctx, sessionID); err != nil {
+		return err
+	}
+
+	response, err := RunStep(ctx, "renegotiate", func() (map[string]interface{}, error) {
+		return h.cloudflareService.Renegotiate(sessionID, request.SessionDescription.toMap())
+	})
+	var apiErr *CloudflareAPIError
+	if errors.As(err, &apiErr) {
+		exists, existsErr := RunStep(ctx, "check-session", func() (bool, error) {
+			return h.cloudflareService.SessionExists(sessionID)
+		})
+		if existsErr != nil {
+			return NewMessageError(ErrCodeCloudflare, "failed to restart ICE: %v", existsErr)
+		}
+		if !exists {
+			return h.recreateSession(ctx, sessionID, request)
+		}
+	}
+	if err != nil {
+		return NewMessageError(ErrCodeCloudflare, "failed to restart ICE: %v", err)
+	}
+
+	_, err = RunStep(ctx, "forward-response", func() (common.Hash, error) {
+		return h.forwardToFrontend(ctx.RoomID, ctx.Sender, IceRestartResponse{
+			MessageHeader:      responseHeader("ice-restart-response", ctx.RequestID),
+			ResponseEnvelope:   successEnvelope("ice-restart"),
+			SessionID:          sessionID,
+			SessionDescription: response["sessionDescription"],
+		}, false)
+	})
+	if err != nil {
+		return NewMessageError(ErrCodeContract, "error forwarding response to frontend: %v", err)
+	}
+	return nil
+}
+
+// recreateSession replaces an expired session: it publishes the tracks of the old session in a new one
+// with the restarted offer, answers the sender, then moves the participant to the new session on the contract
+func (h *EventHandler) recreateSession(ctx *MessageContext, expiredSessionID string, request IceRestartRequest) error {
+	ctx.Logf("Session %s expired, recreating it", expiredSessionID)
+
+	tracks := request.Tracks
+	if len(tracks) == 0 {
+		contractTracks, err := h.GetParticipantTracks(ctx.RoomID, ctx.Sender)
+		if err != nil {
+			return NewMessageError(ErrCodeContract, "error reading tracks of session %s: %v", expiredSessionID, err)
+		}
+		for _, track := range contractTracks {
+			if track.SessionId == expiredSessionID && (track.Location == "" || track.Location == "local") {
+				tracks = append(tracks, TrackDescriptor{TrackName: track.TrackName, Mid: track.Mid, Location: "local"})
+			}
+		}
+	}
+	if len(tracks) == 0 {
+		return NewMessageError(ErrCodeInvalidRequest, "session %s expired and has no tracks to republish", expiredSessionID)
+	}
+
+	sessionID, err := RunStep(ctx, "recreate-session", h.cloudflareService.CreateSession)
+	if err != nil {
+		return NewMessageError(ErrCodeSessionFailed, "error recreating session: %v", err)
+	}
+	h.recordSession(ctx, sessionID)
+
+	formattedTracks := make([]map[string]interface{}, len(tracks))
+	for i, track := range tracks {
+		formattedTracks[i] = map[string]interface{}{
+			"trackName": track.TrackName,
+			"mid":       track.Mid,
+			"location":  track.Location,
+		}
+	}
+	response, err := RunStep(ctx, "republish-tracks", func() (map[string]interface{}, error) {
+		return h.cloudflareService.PublishTracks(sessionID, request.SessionDescription.toMap(), formattedTracks)
+	})
+	if err != nil {
+		return NewMessageError(ErrCodeCloudflare, "error republishing tracks: %v", err)
+	}
+	if h.sessions != nil {
+		if err := h.sessions.Remove(expiredSessionID); err != nil {
+			ctx.Logf("%v", err)
+		}
+	}
+
+	_, err = RunStep(ctx, "forward-response", func() (common.Hash, error) {
+		return h.forwardToFrontend(ctx.RoomID, ctx.Sender, IceRestartResponse{
+			MessageHeader:      responseHeader("ice-restart-response", ctx.RequestID),
+			ResponseEnvelope:   successEnvelope("ice-restart"),
+			SessionID:          sessionID,
+			SessionDescription: response["sessionDescription"],
+			Recreated:          true,
+			PreviousSessionID:  expiredSessionID,
+			Tracks:             tracks,
+		}, false)
+	})
+	if err != nil {
+		return NewMessageError(ErrCodeContract, "error forwarding response to frontend: %v", err)
+	}
+	ctx.Logf("Recreated session %s as %s with %d tracks", expiredSessionID, sessionID, len(tracks))
+
+	_, err = RunStep(ctx, "set-session-id", func() (common.Hash, error) {
+		return h.smCallManager.SetParticipantSessionID(ctx.RoomID, ctx.Sender, sessionID)
+	})
+	if err != nil {
+		ctx.Logf("Error updating session ID in contract: %v", err)
+	}
+	h.addPublishedTracks(ctx, sessionID, response, tracks)
+	return nil
+}
+
+// contractSession returns the session of the sender as stored on the contract. It reads the contract
+// rather than the projection, which keeps the session a participant joined with until it sees the
+// session update of a later request.
+func (h *EventHandler) contractSession(ctx *MessageContext) (string, error) {
+	opts := &bind.CallOpts{Context: context.Background(), From: ctx.Sender}
+	joined, err := h.contractInstance.ParticipantsInRoom(opts, ctx.RoomID, ctx.Sender)
+	if err != nil {
+		return "", NewMessageError(ErrCodeContract, "error reading participants of room %s: %v", ctx.RoomID, err)
+	}
+	if !joined {
+		return "", NewMessageError(ErrCodeUnauthorized, "%s is not a participant of room %s", ctx.Sender.Hex(), ctx.RoomID)
+	}
+
+	participant, err := h.contractInstance.GetParticipantInfo(opts, ctx.RoomID)
+	if err != nil {
+		return "", NewMessageError(ErrCodeContract, "error reading participant %s of room %s: %v", ctx.Sender.Hex(), ctx.RoomID, err)
+	}
+	if participant.SessionID == "" {
+		return "", NewMessageError(ErrCodeInvalidRequest, "%s has no session in room %s", ctx.Sender.Hex(), ctx.RoomID)
+	}
+	return participant.SessionID, nil
+}
@@ -0,0 +1,48 @@
+package handle
+
+import (
+	"context"
+	"fmt"
+
+	contract "dappmeetingnew/constract"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// joinRoomName decodes the display name a participant passed to joinRoom from the input of the
+// transaction that emitted its ParticipantJoined event. Unlike the contract views, the input still
+// holds the name after the participant left, and during a reindex it is the name used at the time.
+func joinRoomName(client *ethclient.Client, txHash common.Hash) (string, error) {
+	if client == nil {
+		return "", fmt.Errorf("no Ethereum client to read transaction %s", txHash.Hex())
+	}
+	tx, _, err := client.TransactionByHash(context.Background(), txHash)
+	if err != nil {
+		return "", fmt.Errorf("error reading transaction %s: %v", txHash.Hex(), err)
+	}
+	input := tx.Data()
+	if len(input) < 4 {
+		return "", fmt.Errorf("transaction %s has no call data", txHash.Hex())
+	}
+
+	contractABI, err := contract.ContractMetaData.GetAbi()
+	if err != nil {
+		return "", err
+	}
+	method, err := contractABI.MethodById(input[:4])
+	if err != nil || method.Name != "joinRoom" {
+		return "", fmt.Errorf("transaction %s does not call joinRoom", txHash.Hex())
+	}
+	args, err := method.Inputs.Unpack(input[4:])
+	if err != nil {
+		return "", fmt.Errorf("error decoding joinRoom input of transaction %s: %v", txHash.Hex(), err)
+	}
+	for i, input := range method.Inputs {
+		if input.Name == "_name" {
+			name, _ := args[i].(string)
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("joinRoom has no _name input")
+}
@@ -0,0 +1,104 @@
+package handle
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// JSONLSink appends records to a JSON Lines file, rotating it by size.
+// Rotated files are named <path>.1 (newest) up to <path>.<maxFiles>.
+type JSONLSink struct {
+	mu       sync.Mutex
+	path     string
+	maxBytes int64
+	maxFiles int
+	file     *os.File
+	size     int64
+}
+
+// NewJSONLSink opens the file sink; maxBytes <= 0 disables rotation
+func NewJSONLSink(path string, maxBytes int64, maxFiles int) (*JSONLSink, error) {
+	if maxFiles <= 0 {
+		maxFiles = 5
+	}
+	s := &JSONLSink{path: path, maxBytes: maxBytes, maxFiles: maxFiles}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// open opens the current file for appending
+func (s *JSONLSink) open() error {
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open event sink file: %v", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to open event sink file: %v", err)
+	}
+	s.file = file
+	s.size = info.Size()
+	return nil
+}
+
+// Publish appends one JSON line, rotating first when the line would overflow the file
+func (s *JSONLSink) Publish(record SinkRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("error marshaling sink record: %v", err)
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return fmt.Errorf("event sink file is closed")
+	}
+	if s.maxBytes > 0 && s.size > 0 && s.size+int64(len(line)) > s.maxBytes {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	return err
+}
+
+// rotate shifts the rotated files up by one and starts a new current file
+func (s *JSONLSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return fmt.Errorf("failed to close event sink file: %v", err)
+	}
+	s.file = nil
+
+	os.Remove(fmt.Sprintf("%s.%d", s.path, s.maxFiles))
+	for i := s.maxFiles - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", s.path, i), fmt.Sprintf("%s.%d", s.path, i+1))
+	}
+	if err := os.Rename(s.path, s.path+".1"); err != nil {
+		// Keep appending to the current file rather than losing records
+		s.open()
+		return fmt.Errorf("failed to rotate event sink file: %v", err)
+	}
+	return s.open()
+}
+
+// Close closes the current file
+func (s *JSONLSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
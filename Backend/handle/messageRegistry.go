@@ -0,0 +1,284 @@
+package handle
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// MessageContext carries one EventForwardedToBackend message through middleware and its handler
+type MessageContext struct {
+	Context   context.Context
+	RoomID    string
+	Sender    common.Address
+	Type      string
+	RequestID string                 // client requestId, or <txHash>:<logIndex> of the request log
+	Payload   map[string]interface{} // decoded event data
+	Raw       types.Log
+
+	handler    *EventHandler
+	retry      bool   // set when a dead letter is retried
+	failedStep string // name of the handler step that failed
+}
+
+// logRequestID returns the default request ID of a contract log
+func logRequestID(raw types.Log) string {
+	return fmt.Sprintf("%s:%d", raw.TxHash.Hex(), raw.Index)
+}
+
+// Logf logs a line tagged with the request ID
+func (c *MessageContext) Logf(format string, args ...interface{}) {
+	log.Printf("[Request %s] "+format, append([]interface{}{c.RequestID}, args...)...)
+}
+
+// Reply sends a JSON payload back to the sender through the contract
+func (c *MessageContext) Reply(payload interface{}) (common.Hash, error) {
+	if c.handler == nil {
+		return common.Hash{}, fmt.Errorf("message context has no handler to reply with")
+	}
+	return c.handler.forwardToFrontend(c.RoomID, c.Sender, payload, false)
+}
+
+// Machine-readable error codes reported to the frontend
+const (
+	ErrCodeInvalidRequest  = "invalid_request"
+	ErrCodeUnsupportedType = "unsupported_type"
+	ErrCodeUnauthorized    = "unauthorized"
+	ErrCodeRateLimited     = "rate_limited"
+	ErrCodeSessionFailed   = "session_failed"
+	ErrCodeCloudflare      = "cloudflare_error"
+	ErrCodeContract        = "contract_error"
+	ErrCodeInternal        = "internal_error"
+)
+
+// retryableErrorCodes are the failures a client may retry unchanged
+var retryableErrorCodes = map[string]bool{
+	ErrCodeRateLimited:   true,
+	ErrCodeSessionFailed: true,
+	ErrCodeCloudflare:    true,
+	ErrCodeContract:      true,
+	ErrCodeInternal:      true,
+}
+
+// MessageError is a handling failure that is reported back to the sender
+type MessageError struct {
+	Code      string
+	Message   string
+	Retryable bool
+	Fields    ValidationErrors
+}
+
+// Error implements the error interface
+func (e *MessageError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// NewMessageError creates an error that is reported back to the sender, retryable according to its code
+func NewMessageError(code string, format string, args ...interface{}) *MessageError {
+	return &MessageError{Code: code, Message: fmt.Sprintf(format, args...), Retryable: retryableErrorCodes[code]}
+}
+
+// asMessageError reports any error as a MessageError, internal unless it already is one
+func asMessageError(err error) *MessageError {
+	if messageErr, ok := err.(*MessageError); ok {
+		return messageErr
+	}
+	return NewMessageError(ErrCodeInternal, "%v", err)
+}
+
+// MessageHandlerFunc handles a message after middleware ran
+type MessageHandlerFunc func(ctx *MessageContext) error
+
+// MessageMiddleware wraps message handlers, for auth, logging or rate limits
+type MessageMiddleware func(next MessageHandlerFunc) MessageHandlerFunc
+
+// MessageRegistry maps EventForwardedToBackend message types to their handlers
+type MessageRegistry struct {
+	mu         sync.RWMutex
+	handlers   map[string]MessageHandlerFunc
+	middleware []MessageMiddleware
+}
+
+// NewMessageRegistry creates an empty registry
+func NewMessageRegistry() *MessageRegistry {
+	return &MessageRegistry{handlers: make(map[string]MessageHandlerFunc)}
+}
+
+// Use appends middleware; the first one added runs outermost
+func (r *MessageRegistry) Use(middleware ...MessageMiddleware) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.middleware = append(r.middleware, middleware...)
+}
+
+// HandleFunc registers an untyped handler for a message type, replacing any previous one
+func (r *MessageRegistry) HandleFunc(typeName string, handler MessageHandlerFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handlers[typeName] = handler
+}
+
+// Register adds a message type with a typed decoder and handler.
+// The decoder turns the message payload into T; decoding errors are reported to the sender.
+func Register[T any](r *MessageRegistry, typeName string, decode func(ctx *MessageContext) (T, error), handle func(ctx *MessageContext, message T) error) {
+	r.HandleFunc(typeName, func(ctx *MessageContext) error {
+		message, err := decode(ctx)
+		if err != nil {
+			switch decodeErr := err.(type) {
+			case *MessageError:
+				return decodeErr
+			case ValidationErrors:
+				messageErr := NewMessageError(ErrCodeInvalidRequest, "invalid %s message: %v", typeName, decodeErr)
+				messageErr.Fields = decodeErr
+				return messageErr
+			}
+			return NewMessageError(ErrCodeInvalidRequest, "invalid %s message: %v", typeName, err)
+		}
+		return handle(ctx, message)
+	})
+}
+
+// DecodeJSON is a decoder that maps the message payload onto T through its JSON tags
+func DecodeJSON[T any](ctx *MessageContext) (T, error) {
+	var message T
+	payloadBytes, err := json.Marshal(ctx.Payload)
+	if err != nil {
+		return message, err
+	}
+	err = json.Unmarshal(payloadBytes, &message)
+	return message, err
+}
+
+// Has reports whether a message type is registered
+func (r *MessageRegistry) Has(typeName string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.handlers[typeName]
+	return ok
+}
+
+// Types lists the registered message types
+func (r *MessageRegistry) Types() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.handlers))
+	for name := range r.handlers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Dispatch runs the middleware chain and the handler registered for the message type.
+// Unknown types fail with an unsupported_type MessageError after the middleware ran.
+func (r *MessageRegistry) Dispatch(ctx *MessageContext) error {
+	r.mu.RLock()
+	handler, ok := r.handlers[ctx.Type]
+	middleware := r.middleware
+	r.mu.RUnlock()
+
+	if !ok {
+		handler = func(ctx *MessageContext) error {
+			if ctx.Type == "" {
+				return NewMessageError(ErrCodeInvalidRequest, "missing message type")
+			}
+			return NewMessageError(ErrCodeUnsupportedType, "unsupported message type: %s", ctx.Type)
+		}
+	}
+
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	return handler(ctx)
+}
+
+// LoggingMiddleware logs every message with its outcome and duration
+func LoggingMiddleware() MessageMiddleware {
+	return func(next MessageHandlerFunc) MessageHandlerFunc {
+		return func(ctx *MessageContext) error {
+			start := time.Now()
+			err := next(ctx)
+			if err != nil {
+				ctx.Logf("%s from %s in room %s failed after %s: %v",
+					ctx.Type, ctx.Sender.Hex(), ctx.RoomID, time.Since(start), err)
+			} else {
+				ctx.Logf("%s from %s in room %s handled in %s",
+					ctx.Type, ctx.Sender.Hex(), ctx.RoomID, time.Since(start))
+			}
+			return err
+		}
+	}
+}
+
+// DedupeMiddleware skips requests whose request ID the sender already used within ttl.
+// A request that failed with a retryable error may be sent again with the same ID,
+// and dead letter retries always go through.
+func DedupeMiddleware(ttl time.Duration) MessageMiddleware {
+	var mu sync.Mutex
+	seen := make(map[string]time.Time)
+
+	return func(next MessageHandlerFunc) MessageHandlerFunc {
+		return func(ctx *MessageContext) error {
+			if ctx.retry {
+				return next(ctx)
+			}
+
+			key := ctx.Sender.Hex() + "/" + ctx.RequestID
+			now := time.Now()
+
+			mu.Lock()
+			for seenKey, seenAt := range seen {
+				if now.Sub(seenAt) > ttl {
+					delete(seen, seenKey)
+				}
+			}
+			if _, duplicate := seen[key]; duplicate {
+				mu.Unlock()
+				ctx.Logf("Skipping duplicate %s request from %s", ctx.Type, ctx.Sender.Hex())
+				return nil
+			}
+			seen[key] = now
+			mu.Unlock()
+
+			err := next(ctx)
+			if err != nil && asMessageError(err).Retryable {
+				mu.Lock()
+				delete(seen, key)
+				mu.Unlock()
+			}
+			return err
+		}
+	}
+}
+
+// AuthMiddleware rejects messages the authorize function refuses with an unauthorized reply
+func AuthMiddleware(authorize func(ctx *MessageContext) error) MessageMiddleware {
+	return func(next MessageHandlerFunc) MessageHandlerFunc {
+		return func(ctx *MessageContext) error {
+			if err := authorize(ctx); err != nil {
+				return NewMessageError(ErrCodeUnauthorized, "not authorized: %v", err)
+			}
+			return next(ctx)
+		}
+	}
+}
+
+// RateLimitMiddleware rejects messages the allow function refuses with a rate_limited reply
+func RateLimitMiddleware(allow func(ctx *MessageContext) bool) MessageMiddleware {
+	return func(next MessageHandlerFunc) MessageHandlerFunc {
+		return func(ctx *MessageContext) error {
+			if !allow(ctx) {
+				return NewMessageError(ErrCodeRateLimited, "rate limit exceeded for %s", ctx.Type)
+			}
+			return next(ctx)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package handle
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// MessageSchema describes one message type exchanged with the frontend
+type MessageSchema struct {
+	Name      string      // file name of the generated schema
+	Type      string      // value of the "type" field, empty when it varies
+	Direction string      // "request" for frontend to backend, "response" or "notification" for backend to frontend
+	Value     interface{} // zero value of the Go struct
+}
+
+// MessageSchemas lists every request and response type with a published schema
+var MessageSchemas = []MessageSchema{
+	{Name: "publish-track.request", Type: "publish-track", Direction: "request", Value: PublishTrackRequest{}},
+	{Name: "publish-track.data", Direction: "request", Value: PublishTrackData{}},
+	{Name: "pull-track.request", Type: "pull-track", Direction: "request", Value: PullTrackRequest{}},
+	{Name: "pull-track.data", Direction: "request", Value: PullTrackData{}},
+	{Name: "close-track.request", Type: "close-track", Direction: "request", Value: CloseTrackRequest{}},
+	{Name: "renegotiation.request", Type: "renegotiation", Direction: "request", Value: RenegotiationRequest{}},
+	{Name: "renegotiation.data", Direction: "request", Value: RenegotiationData{}},
+	{Name: "publish-datachannel.request", Type: "publish-datachannel", Direction: "request", Value: PublishDataChannelRequest{}},
+	{Name: "subscribe-datachannel.request", Type: "subscribe-datachannel", Direction: "request", Value: SubscribeDataChannelRequest{}},
+	{Name: "set-layer.request", Type: "set-layer", Direction: "request", Value: SetLayerRequest{}},
+	{Name: "ice-restart.request", Type: "ice-restart", Direction: "request", Value: IceRestartRequest{}},
+	{Name: "ice-restart.data", Direction: "request", Value: IceRestartData{}},
+	{Name: "broadcast.request", Type: "broadcast", Direction: "request", Value: BroadcastRequest{}},
+	{Name: "chat-send.request", Type: "chat-send", Direction: "request", Value: ChatSendRequest{}},
+	{Name: "chat-history.request", Type: "chat-history", Direction: "request", Value: ChatHistoryRequest{}},
+	{Name: "join-room.response", Type: "join-room", Direction: "response", Value: JoinRoomResponse{}},
+	{Name: "publish-track.response", Type: "publish-track-response", Direction: "response", Value: PublishTrackResponse{}},
+	{Name: "pull-track.response", Type: "pull-track-response", Direction: "response", Value: PullTrackResponse{}},
+	{Name: "close-track.response", Type: "close-track-response", Direction: "response", Value: CloseTrackResponse{}},
+	{Name: "renegotiation.response", Type: "renegotiation-response", Direction: "response", Value: RenegotiationResponse{}},
+	{Name: "publish-datachannel.response", Type: "publish-datachannel-response", Direction: "response", Value: DataChannelResponse{}},
+	{Name: "subscribe-datachannel.response", Type: "subscribe-datachannel-response", Direction: "response", Value: DataChannelResponse{}},
+	{Name: "set-layer.response", Type: "set-layer-response", Direction: "response", Value: SetLayerResponse{}},
+	{Name: "ice-restart.response", Type: "ice-restart-response", Direction: "response", Value: IceRestartResponse{}},
+	{Name: "broadcast.response", Type: "broadcast-response", Direction: "response", Value: BroadcastResponse{}},
+	{Name: "chat-send.response", Type: "chat-send-response", Direction: "response", Value: ChatSendResponse{}},
+	{Name: "chat-history.response", Type: "chat-history-response", Direction: "response", Value: ChatHistoryResponse{}},
+	{Name: "error.response", Direction: "response", Value: ErrorResponse{}},
+	{Name: "track-available.notification", Type: "track-available", Direction: "notification", Value: TrackAvailableNotification{}},
+	{Name: "broadcast.notification", Type: "broadcast", Direction: "notification", Value: BroadcastNotification{}},
+	{Name: "chat-message.notification", Type: "chat-message", Direction: "notification", Value: ChatMessageNotification{}},
+	{Name: "participant-left.notification", Type: "participant-left", Direction: "notification", Value: ParticipantLeftNotification{}},
+	{Name: "session-closed.notification", Type: "session-closed", Direction: "notification", Value: SessionClosedNotification{}},
+}
+
+// GenerateJSONSchema builds a JSON Schema document from the message struct.
+// Fields without omitempty are required and unknown fields are rejected, like the backend decoder.
+func GenerateJSONSchema(schema MessageSchema) map[string]interface{} {
+	document := schemaFor(reflect.TypeOf(schema.Value))
+	document["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	document["$id"] = schema.Name + ".json"
+	document["title"] = reflect.TypeOf(schema.Value).Name()
+	document["description"] = fmt.Sprintf("Schema version %d %s message", MessageSchemaVersion, schema.Direction)
+
+	if schema.Type != "" {
+		if properties, ok := document["properties"].(map[string]interface{}); ok {
+			if typeProperty, ok := properties["type"].(map[string]interface{}); ok {
+				typeProperty["const"] = schema.Type
+			}
+		}
+	}
+	return document
+}
+
+// schemaFor maps a Go type onto a JSON Schema fragment
+func schemaFor(t reflect.Type) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return schemaFor(t.Elem())
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": schemaFor(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object"}
+	case reflect.Struct:
+		properties := make(map[string]interface{})
+		required := []string{}
+		addStructFields(t, properties, &required)
+		document := map[string]interface{}{
+			"type":                 "object",
+			"properties":           properties,
+			"additionalProperties": false,
+		}
+		if len(required) > 0 {
+			document["required"] = required
+		}
+		return document
+	default:
+		// interface{} values are passed through from Cloudflare unchanged
+		return map[string]interface{}{}
+	}
+}
+
+// addStructFields adds the JSON fields of a struct, flattening embedded structs
+func addStructFields(t reflect.Type, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			addStructFields(field.Type, properties, required)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = field.Name
+		}
+
+		property := schemaFor(field.Type)
+		if doc := field.Tag.Get("doc"); doc != "" {
+			property["description"] = doc
+		}
+		properties[name] = property
+
+		if !strings.Contains(options, "omitempty") {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// WriteMessageSchemas writes one <name>.json schema file per message into dir
+func WriteMessageSchemas(dir string) ([]string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create schema directory: %v", err)
+	}
+
+	var written []string
+	for _, schema := range MessageSchemas {
+		content, err := json.MarshalIndent(GenerateJSONSchema(schema), "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode schema %s: %v", schema.Name, err)
+		}
+
+		path := filepath.Join(dir, schema.Name+".json")
+		if err := os.WriteFile(path, append(content, '\n'), 0644); err != nil {
+			return nil, fmt.Errorf("failed to write schema %s: %v", schema.Name, err)
+		}
+		written = append(written, path)
+	}
+	return written, nil
+}
@@ -0,0 +1,851 @@
+package handle
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// MessageSchemaVersion is the version of the frontend/backend message schemas.
+// Requests without a version are treated as version 1.
+const MessageSchemaVersion = 1
+
+// FieldError is a validation failure of one message field
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationErrors lists every field that failed validation
+type ValidationErrors []FieldError
+
+// Error implements the error interface
+func (v ValidationErrors) Error() string {
+	parts := make([]string, len(v))
+	for i, fieldErr := range v {
+		if fieldErr.Field == "" {
+			parts[i] = fieldErr.Message
+		} else {
+			parts[i] = fieldErr.Field + ": " + fieldErr.Message
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+// add records a field error
+func (v *ValidationErrors) add(field string, format string, args ...interface{}) {
+	*v = append(*v, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// required records an error when the value is empty
+func (v *ValidationErrors) required(field string, value string) {
+	if value == "" {
+		v.add(field, "is required")
+	}
+}
+
+// MessageRequest is a request payload that checks itself after decoding.
+// Validate may fill fields from compressed data and legacy names before checking them.
+type MessageRequest interface {
+	Validate() ValidationErrors
+}
+
+// MessageHeader holds the fields every message carries
+type MessageHeader struct {
+	Version   int    `json:"version,omitempty" doc:"Schema version, 1 when omitted"`
+	Type      string `json:"type" doc:"Message type"`
+	RequestID string `json:"requestId,omitempty" doc:"Correlation ID echoed in the response, <txHash>:<logIndex> of the request when omitted"`
+	Timestamp int64  `json:"timestamp,omitempty" doc:"Sender time in milliseconds since the epoch"`
+}
+
+// validateHeader checks the schema version
+func (m MessageHeader) validateHeader(errs *ValidationErrors) {
+	if m.Version < 0 || m.Version > MessageSchemaVersion {
+		errs.add("version", "unsupported version %d, the backend speaks version %d", m.Version, MessageSchemaVersion)
+	}
+}
+
+// responseHeader builds the header of a backend response to a request
+func responseHeader(messageType string, requestID string) MessageHeader {
+	return MessageHeader{Version: MessageSchemaVersion, Type: messageType, RequestID: requestID}
+}
+
+// ResponseEnvelope is the outcome part shared by every backend response
+type ResponseEnvelope struct {
+	RequestType string `json:"requestType" doc:"Type of the request this response answers"`
+	Success     bool   `json:"success" doc:"Whether the request succeeded"`
+	ErrorCode   string `json:"errorCode,omitempty" doc:"Machine-readable error code when success is false"`
+	Message     string `json:"message,omitempty" doc:"Human-readable error message"`
+	Retryable   bool   `json:"retryable,omitempty" doc:"Whether sending the same request again may succeed"`
+}
+
+// successEnvelope builds the envelope of a successful response
+func successEnvelope(requestType string) ResponseEnvelope {
+	return ResponseEnvelope{RequestType: requestType, Success: true}
+}
+
+// SessionDescription is a WebRTC session description
+type SessionDescription struct {
+	Type string `json:"type" doc:"offer or answer"`
+	SDP  string `json:"sdp" doc:"SDP body"`
+}
+
+// validate checks the description fields
+func (d *SessionDescription) validate(field string, errs *ValidationErrors) {
+	if d.Type != "offer" && d.Type != "answer" {
+		errs.add(field+".type", "must be offer or answer")
+	}
+	errs.required(field+".sdp", d.SDP)
+}
+
+// toMap converts the description for the Cloudflare API
+func (d *SessionDescription) toMap() map[string]interface{} {
+	if d == nil {
+		return nil
+	}
+	return map[string]interface{}{"type": d.Type, "sdp": d.SDP}
+}
+
+// ridPattern matches the simulcast RIDs accepted by the backend
+var ridPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,16}$`)
+
+// SimulcastEncoding describes one simulcast layer of a published track
+type SimulcastEncoding struct {
+	Rid                   string  `json:"rid" doc:"RID of the layer, as in the a=rid line of the offer"`
+	MaxBitrate            int     `json:"maxBitrate,omitempty" doc:"Maximum bitrate of the layer in bits per second"`
+	ScaleResolutionDownBy float64 `json:"scaleResolutionDownBy,omitempty" doc:"Resolution divisor of the layer"`
+}
+
+// TrackDescriptor describes a local track to publish
+type TrackDescriptor struct {
+	TrackName string              `json:"trackName" doc:"Track name, unique within the session"`
+	Mid       string              `json:"mid" doc:"Transceiver mid in the offer"`
+	Location  string              `json:"location,omitempty" doc:"Track location, local when omitted"`
+	Encodings []SimulcastEncoding `json:"encodings,omitempty" doc:"Simulcast layers sent by the publisher, announced to subscribers"`
+}
+
+// validate checks the track fields and that every simulcast layer is offered in the SDP
+func (t *TrackDescriptor) validate(field string, offer *SessionDescription, errs *ValidationErrors) {
+	errs.required(field+".trackName", t.TrackName)
+	errs.required(field+".mid", t.Mid)
+	if t.Location == "" {
+		t.Location = "local"
+	}
+
+	seen := make(map[string]bool, len(t.Encodings))
+	for i, encoding := range t.Encodings {
+		encodingField := fmt.Sprintf("%s.encodings[%d]", field, i)
+		switch {
+		case !ridPattern.MatchString(encoding.Rid):
+			errs.add(encodingField+".rid", "must be 1 to 16 letters, digits, - or _")
+		case seen[encoding.Rid]:
+			errs.add(encodingField+".rid", "duplicates rid %s", encoding.Rid)
+		case offer != nil && !strings.Contains(offer.SDP, "a=rid:"+encoding.Rid+" send"):
+			errs.add(encodingField+".rid", "rid %s is not sent in the offer", encoding.Rid)
+		}
+		seen[encoding.Rid] = true
+		if encoding.MaxBitrate < 0 {
+			errs.add(encodingField+".maxBitrate", "must not be negative")
+		}
+		if encoding.ScaleResolutionDownBy != 0 && encoding.ScaleResolutionDownBy < 1 {
+			errs.add(encodingField+".scaleResolutionDownBy", "must be at least 1")
+		}
+	}
+}
+
+// rids lists the RIDs of the simulcast layers
+func (t TrackDescriptor) rids() []string {
+	rids := make([]string, len(t.Encodings))
+	for i, encoding := range t.Encodings {
+		rids[i] = encoding.Rid
+	}
+	return rids
+}
+
+// PublishTrackData is the compressed part of a publish-track request
+type PublishTrackData struct {
+	Offer    *SessionDescription    `json:"offer" doc:"SDP offer with the tracks to publish"`
+	Tracks   []TrackDescriptor      `json:"tracks" doc:"Tracks to publish"`
+	Metadata map[string]interface{} `json:"metadata,omitempty" doc:"Free-form participant metadata"`
+}
+
+// PublishTrackRequest asks the backend to publish local tracks in a new session
+type PublishTrackRequest struct {
+	MessageHeader
+	SessionID      string                 `json:"sessionId,omitempty" doc:"Current session of the sender, informational"`
+	CompressedData string                 `json:"compressedData,omitempty" doc:"zlib: prefixed base64 of the compressed offer and tracks"`
+	Offer          *SessionDescription    `json:"offer,omitempty" doc:"SDP offer, when not compressed"`
+	Tracks         []TrackDescriptor      `json:"tracks,omitempty" doc:"Tracks to publish, when not compressed"`
+	Metadata       map[string]interface{} `json:"metadata,omitempty" doc:"Free-form participant metadata"`
+}
+
+// Validate inflates compressed data and checks the offer and tracks
+func (r *PublishTrackRequest) Validate() ValidationErrors {
+	var errs ValidationErrors
+	r.validateHeader(&errs)
+
+	if r.CompressedData != "" {
+		var data PublishTrackData
+		if err := decodeCompressed(r.CompressedData, &data, "compressedData", &errs); err == nil {
+			r.Offer, r.Tracks, r.Metadata = data.Offer, data.Tracks, data.Metadata
+		}
+		if len(errs) > 0 {
+			return errs
+		}
+	}
+
+	if r.Offer == nil {
+		errs.add("offer", "is required")
+	} else {
+		r.Offer.validate("offer", &errs)
+	}
+	if len(r.Tracks) == 0 {
+		errs.add("tracks", "needs at least one track")
+	}
+	for i := range r.Tracks {
+		r.Tracks[i].validate(fmt.Sprintf("tracks[%d]", i), r.Offer, &errs)
+	}
+	return errs
+}
+
+// maxPullTracks caps the tracks of one pull-track request
+const maxPullTracks = 64
+
+// RemoteTrack identifies a track of another session to pull
+type RemoteTrack struct {
+	RemoteSessionID string `json:"remoteSessionId" doc:"Session that published the track"`
+	TrackName       string `json:"trackName" doc:"Name of the remote track"`
+	PreferredRid    string `json:"preferredRid,omitempty" doc:"Simulcast layer to receive, the publisher's default when omitted"`
+}
+
+// PullTrackData is the compressed part of a pull-track request
+type PullTrackData struct {
+	SessionID       string        `json:"sessionId" doc:"Session that receives the tracks"`
+	RemoteSessionID string        `json:"remoteSessionId,omitempty" doc:"Session that published the track, for a single track"`
+	TrackName       string        `json:"trackName,omitempty" doc:"Name of the remote track, for a single track"`
+	PreferredRid    string        `json:"preferredRid,omitempty" doc:"Simulcast layer to receive, for a single track"`
+	Tracks          []RemoteTrack `json:"tracks,omitempty" doc:"Tracks to pull"`
+	Timestamp       int64         `json:"timestamp,omitempty" doc:"Sender time in milliseconds since the epoch"`
+}
+
+// PullTrackRequest asks the backend to pull remote tracks into the sender's session.
+// A single track may be given with remoteSessionId and trackName instead of tracks.
+type PullTrackRequest struct {
+	MessageHeader
+	SessionID       string        `json:"sessionId,omitempty" doc:"Session that receives the tracks"`
+	RemoteSessionID string        `json:"remoteSessionId,omitempty" doc:"Session that published the track, for a single track"`
+	TrackName       string        `json:"trackName,omitempty" doc:"Name of the remote track, for a single track"`
+	PreferredRid    string        `json:"preferredRid,omitempty" doc:"Simulcast layer to receive, for a single track"`
+	Tracks          []RemoteTrack `json:"tracks,omitempty" doc:"Tracks to pull in one Cloudflare call"`
+	CompressedData  string        `json:"compressedData,omitempty" doc:"zlib: prefixed base64 of the compressed pull data"`
+}
+
+// Validate inflates compressed data, folds a single track into tracks and checks them
+func (r *PullTrackRequest) Validate() ValidationErrors {
+	var errs ValidationErrors
+	r.validateHeader(&errs)
+
+	if r.CompressedData != "" {
+		var data PullTrackData
+		if err := decodeCompressed(r.CompressedData, &data, "compressedData", &errs); err == nil {
+			r.SessionID, r.RemoteSessionID, r.TrackName = data.SessionID, data.RemoteSessionID, data.TrackName
+			r.PreferredRid, r.Tracks = data.PreferredRid, data.Tracks
+		}
+		if len(errs) > 0 {
+			return errs
+		}
+	}
+
+	errs.required("sessionId", r.SessionID)
+	if len(r.Tracks) == 0 {
+		errs.required("remoteSessionId", r.RemoteSessionID)
+		errs.required("trackName", r.TrackName)
+		if r.PreferredRid != "" && !ridPattern.MatchString(r.PreferredRid) {
+			errs.add("preferredRid", "must be 1 to 16 letters, digits, - or _")
+		}
+		r.Tracks = []RemoteTrack{{RemoteSessionID: r.RemoteSessionID, TrackName: r.TrackName, PreferredRid: r.PreferredRid}}
+		return errs
+	}
+
+	if r.RemoteSessionID != "" || r.TrackName != "" {
+		errs.add("tracks", "cannot be combined with remoteSessionId and trackName")
+	}
+	if len(r.Tracks) > maxPullTracks {
+		errs.add("tracks", "has %d tracks, at most %d can be pulled at once", len(r.Tracks), maxPullTracks)
+	}
+	seen := make(map[RemoteTrack]bool, len(r.Tracks))
+	for i, track := range r.Tracks {
+		field := fmt.Sprintf("tracks[%d]", i)
+		errs.required(field+".remoteSessionId", track.RemoteSessionID)
+		errs.required(field+".trackName", track.TrackName)
+		if track.PreferredRid != "" && !ridPattern.MatchString(track.PreferredRid) {
+			errs.add(field+".preferredRid", "must be 1 to 16 letters, digits, - or _")
+		}
+		key := RemoteTrack{RemoteSessionID: track.RemoteSessionID, TrackName: track.TrackName}
+		if seen[key] {
+			errs.add(field, "duplicates track %s of session %s", track.TrackName, track.RemoteSessionID)
+		}
+		seen[key] = true
+	}
+	return errs
+}
+
+// CloseTrackDescriptor identifies a track to close
+type CloseTrackDescriptor struct {
+	Mid string `json:"mid" doc:"Transceiver mid of the track"`
+}
+
+// CloseTrackRequest asks the backend to close tracks of a session
+type CloseTrackRequest struct {
+	MessageHeader
+	SessionID          string                 `json:"sessionId,omitempty" doc:"Session owning the tracks"`
+	LegacySessionID    string                 `json:"sessionID,omitempty" doc:"Deprecated spelling of sessionId"`
+	Tracks             []CloseTrackDescriptor `json:"tracks" doc:"Tracks to close"`
+	Force              bool                   `json:"force,omitempty" doc:"Close without renegotiation"`
+	SessionDescription *SessionDescription    `json:"sessionDescription,omitempty" doc:"SDP offer without the closed tracks"`
+}
+
+// Validate accepts the legacy sessionID spelling and checks the tracks
+func (r *CloseTrackRequest) Validate() ValidationErrors {
+	var errs ValidationErrors
+	r.validateHeader(&errs)
+
+	if r.SessionID == "" {
+		r.SessionID = r.LegacySessionID
+	}
+	errs.required("sessionId", r.SessionID)
+	if len(r.Tracks) == 0 {
+		errs.add("tracks", "needs at least one track")
+	}
+	for i, track := range r.Tracks {
+		errs.required(fmt.Sprintf("tracks[%d].mid", i), track.Mid)
+	}
+	if r.SessionDescription != nil {
+		r.SessionDescription.validate("sessionDescription", &errs)
+	} else if !r.Force {
+		errs.add("sessionDescription", "is required unless force is set")
+	}
+	return errs
+}
+
+// RenegotiationData is the compressed part of a renegotiation request
+type RenegotiationData struct {
+	SessionID          string              `json:"sessionId" doc:"Session to renegotiate"`
+	SessionDescription *SessionDescription `json:"sessionDescription" doc:"SDP answer"`
+}
+
+// RenegotiationRequest sends the sender's SDP answer for a session
+type RenegotiationRequest struct {
+	MessageHeader
+	SessionID          string              `json:"sessionId,omitempty" doc:"Session to renegotiate"`
+	SessionDescription *SessionDescription `json:"sessionDescription,omitempty" doc:"SDP answer"`
+	SDP                string              `json:"sdp,omitempty" doc:"Deprecated bare SDP body, used when sessionDescription is omitted"`
+	SDPType            string              `json:"sdpType,omitempty" doc:"Type of the bare SDP body, answer when omitted"`
+	CompressedData     string              `json:"compressedData,omitempty" doc:"zlib: prefixed base64 of the compressed renegotiation data"`
+}
+
+// Validate inflates compressed data, accepts a bare SDP body and checks the session description
+func (r *RenegotiationRequest) Validate() ValidationErrors {
+	var errs ValidationErrors
+	r.validateHeader(&errs)
+
+	if r.CompressedData != "" {
+		var data RenegotiationData
+		if err := decodeCompressed(r.CompressedData, &data, "compressedData", &errs); err == nil {
+			r.SessionID, r.SessionDescription = data.SessionID, data.SessionDescription
+		}
+		if len(errs) > 0 {
+			return errs
+		}
+	}
+
+	if r.SessionDescription == nil && r.SDP != "" {
+		sdpType := r.SDPType
+		if sdpType == "" {
+			sdpType = "answer"
+		}
+		r.SessionDescription = &SessionDescription{Type: sdpType, SDP: r.SDP}
+	}
+
+	errs.required("sessionId", r.SessionID)
+	if r.SessionDescription == nil {
+		errs.add("sessionDescription", "is required")
+	} else {
+		r.SessionDescription.validate("sessionDescription", &errs)
+	}
+	return errs
+}
+
+// DataChannelLocation is the track location recording a data channel on the contract
+const DataChannelLocation = "datachannel"
+
+// PublishDataChannelRequest opens data channels the sender writes to in one of its sessions
+type PublishDataChannelRequest struct {
+	MessageHeader
+	SessionID    string   `json:"sessionId" doc:"Session of the sender that writes to the channels"`
+	DataChannels []string `json:"dataChannels" doc:"Names of the channels to open, unique within the session"`
+}
+
+// Validate checks the session and channel names
+func (r *PublishDataChannelRequest) Validate() ValidationErrors {
+	var errs ValidationErrors
+	r.validateHeader(&errs)
+
+	errs.required("sessionId", r.SessionID)
+	if len(r.DataChannels) == 0 {
+		errs.add("dataChannels", "needs at least one channel")
+	}
+	seen := make(map[string]bool, len(r.DataChannels))
+	for i, name := range r.DataChannels {
+		field := fmt.Sprintf("dataChannels[%d]", i)
+		errs.required(field, name)
+		if name != "" && seen[name] {
+			errs.add(field, "duplicates channel %s", name)
+		}
+		seen[name] = true
+	}
+	return errs
+}
+
+// RemoteDataChannel identifies a data channel published by another session
+type RemoteDataChannel struct {
+	SessionID       string `json:"sessionId" doc:"Session that published the channel"`
+	DataChannelName string `json:"dataChannelName" doc:"Name of the channel"`
+}
+
+// SubscribeDataChannelRequest opens data channels of other participants for the sender to read
+type SubscribeDataChannelRequest struct {
+	MessageHeader
+	SessionID    string              `json:"sessionId" doc:"Session of the sender that reads the channels"`
+	DataChannels []RemoteDataChannel `json:"dataChannels" doc:"Channels to subscribe to"`
+}
+
+// Validate checks the session and channels
+func (r *SubscribeDataChannelRequest) Validate() ValidationErrors {
+	var errs ValidationErrors
+	r.validateHeader(&errs)
+
+	errs.required("sessionId", r.SessionID)
+	if len(r.DataChannels) == 0 {
+		errs.add("dataChannels", "needs at least one channel")
+	}
+	for i, channel := range r.DataChannels {
+		errs.required(fmt.Sprintf("dataChannels[%d].sessionId", i), channel.SessionID)
+		errs.required(fmt.Sprintf("dataChannels[%d].dataChannelName", i), channel.DataChannelName)
+	}
+	return errs
+}
+
+// SetLayerRequest switches the simulcast layer a subscriber receives for a pulled track
+type SetLayerRequest struct {
+	MessageHeader
+	SessionID       string `json:"sessionId" doc:"Session that receives the track"`
+	RemoteSessionID string `json:"remoteSessionId" doc:"Session that published the track"`
+	TrackName       string `json:"trackName" doc:"Name of the remote track"`
+	Mid             string `json:"mid" doc:"Transceiver mid of the pulled track in the receiving session"`
+	Rid             string `json:"rid" doc:"Simulcast layer to receive"`
+}
+
+// Validate checks the track and layer fields
+func (r *SetLayerRequest) Validate() ValidationErrors {
+	var errs ValidationErrors
+	r.validateHeader(&errs)
+
+	errs.required("sessionId", r.SessionID)
+	errs.required("remoteSessionId", r.RemoteSessionID)
+	errs.required("trackName", r.TrackName)
+	errs.required("mid", r.Mid)
+	if !ridPattern.MatchString(r.Rid) {
+		errs.add("rid", "must be 1 to 16 letters, digits, - or _")
+	}
+	return errs
+}
+
+// IceRestartData is the compressed part of an ice-restart request
+type IceRestartData struct {
+	SessionID          string              `json:"sessionId,omitempty" doc:"Session to restart"`
+	SessionDescription *SessionDescription `json:"sessionDescription" doc:"SDP offer with restarted ICE credentials"`
+	Tracks             []TrackDescriptor   `json:"tracks,omitempty" doc:"Local tracks to republish if the session expired"`
+}
+
+// IceRestartRequest restarts ICE on the sender's session after a network change. When the session
+// has expired the backend creates a new one and republishes the tracks of the old one.
+type IceRestartRequest struct {
+	MessageHeader
+	SessionID          string              `json:"sessionId,omitempty" doc:"Session to restart, the sender's session on the contract when omitted"`
+	SessionDescription *SessionDescription `json:"sessionDescription,omitempty" doc:"SDP offer with restarted ICE credentials"`
+	Tracks             []TrackDescriptor   `json:"tracks,omitempty" doc:"Local tracks to republish if the session expired, the session's tracks on the contract when omitted"`
+	CompressedData     string              `json:"compressedData,omitempty" doc:"zlib: prefixed base64 of the compressed ice-restart data"`
+}
+
+// Validate inflates compressed data and checks the offer and tracks
+func (r *IceRestartRequest) Validate() ValidationErrors {
+	var errs ValidationErrors
+	r.validateHeader(&errs)
+
+	if r.CompressedData != "" {
+		var data IceRestartData
+		if err := decodeCompressed(r.CompressedData, &data, "compressedData", &errs); err == nil {
+			r.SessionID, r.SessionDescription, r.Tracks = data.SessionID, data.SessionDescription, data.Tracks
+		}
+		if len(errs) > 0 {
+			return errs
+		}
+	}
+
+	if r.SessionDescription == nil {
+		errs.add("sessionDescription", "is required")
+	} else {
+		r.SessionDescription.validate("sessionDescription", &errs)
+		if r.SessionDescription.Type != "offer" {
+			errs.add("sessionDescription.type", "must be offer")
+		}
+	}
+	for i := range r.Tracks {
+		r.Tracks[i].validate(fmt.Sprintf("tracks[%d]", i), r.SessionDescription, &errs)
+	}
+	return errs
+}
+
+// BroadcastRequest asks the backend to deliver a room-wide notice to every current participant
+type BroadcastRequest struct {
+	MessageHeader
+	Event       string                 `json:"event" doc:"Notice name, such as recording-started"`
+	Payload     map[string]interface{} `json:"payload,omitempty" doc:"Free-form notice data"`
+	Exclude     []string               `json:"exclude,omitempty" doc:"Wallet addresses that must not receive the notice"`
+	IncludeSelf bool                   `json:"includeSelf,omitempty" doc:"Also deliver the notice to the sender"`
+}
+
+// Validate checks the notice name and the excluded addresses
+func (r *BroadcastRequest) Validate() ValidationErrors {
+	var errs ValidationErrors
+	r.validateHeader(&errs)
+
+	errs.required("event", r.Event)
+	for i, address := range r.Exclude {
+		if !common.IsHexAddress(address) {
+			errs.add(fmt.Sprintf("exclude[%d]", i), "must be a wallet address")
+		}
+	}
+	return errs
+}
+
+// maxChatMessageLength bounds chat messages, every relayed byte is paid for in gas
+const maxChatMessageLength = 2000
+
+// ChatSendRequest sends a chat message to the room
+type ChatSendRequest struct {
+	MessageHeader
+	Message string `json:"message" doc:"Message text"`
+}
+
+// Validate checks the message text
+func (r *ChatSendRequest) Validate() ValidationErrors {
+	var errs ValidationErrors
+	r.validateHeader(&errs)
+
+	r.Message = strings.TrimSpace(r.Message)
+	errs.required("message", r.Message)
+	if len(r.Message) > maxChatMessageLength {
+		errs.add("message", "must be at most %d bytes", maxChatMessageLength)
+	}
+	return errs
+}
+
+// ChatHistoryRequest asks for a page of the room's chat history
+type ChatHistoryRequest struct {
+	MessageHeader
+	Before int64 `json:"before,omitempty" doc:"Only return messages with a lower ID, for the next page"`
+	Limit  int   `json:"limit,omitempty" doc:"Page size, 50 when omitted; long pages are cut to 32 KiB of messages"`
+}
+
+// Validate checks the page cursor and size
+func (r *ChatHistoryRequest) Validate() ValidationErrors {
+	var errs ValidationErrors
+	r.validateHeader(&errs)
+
+	if r.Before < 0 {
+		errs.add("before", "must not be negative")
+	}
+	if r.Limit < 0 || r.Limit > MaxChatHistoryLimit {
+		errs.add("limit", "must be between 1 and %d", MaxChatHistoryLimit)
+	}
+	if r.Limit == 0 {
+		r.Limit = DefaultChatHistoryLimit
+	}
+	return errs
+}
+
+// JoinRoomResponse answers a ParticipantJoined event with the new session
+type JoinRoomResponse struct {
+	MessageHeader
+	ResponseEnvelope
+	SessionID          string                 `json:"sessionId" doc:"Session created for the participant"`
+	LegacySessionID    string                 `json:"sessionID" doc:"Deprecated spelling of sessionId"`
+	CloudflareResponse map[string]interface{} `json:"cloudflareResponse" doc:"Cloudflare answer to the initial tracks"`
+	ChatHistory        []ChatMessage          `json:"chatHistory,omitempty" doc:"Latest chat messages of the room, oldest first"`
+}
+
+// PublishTrackResult is the Cloudflare part of a publish-track response
+type PublishTrackResult struct {
+	SessionDescription interface{} `json:"sessionDescription" doc:"SDP answer"`
+	Tracks             interface{} `json:"tracks" doc:"Published tracks as reported by Cloudflare"`
+	TxHash             interface{} `json:"txHash" doc:"Unused, kept for compatibility"`
+}
+
+// PublishTrackResponse answers a publish-track request
+type PublishTrackResponse struct {
+	MessageHeader
+	ResponseEnvelope
+	CloudflareResponse PublishTrackResult `json:"cloudflareResponse" doc:"Cloudflare answer"`
+}
+
+// PullTrackResponse answers a pull-track request
+type PullTrackResponse struct {
+	MessageHeader
+	ResponseEnvelope
+	SessionID                      string            `json:"sessionId" doc:"Session that receives the tracks"`
+	RequiresImmediateRenegotiation bool              `json:"requiresImmediateRenegotiation" doc:"Whether the sender must renegotiate with sessionDescription"`
+	SessionDescription             interface{}       `json:"sessionDescription,omitempty" doc:"SDP offer to answer with a renegotiation request"`
+	Tracks                         []PullTrackStatus `json:"tracks" doc:"Outcome of every requested track, in request order"`
+}
+
+// Pull track statuses
+const (
+	PullStatusPulled   = "pulled"
+	PullStatusNotFound = "not_found"
+	PullStatusFailed   = "failed"
+)
+
+// PullTrackStatus is the outcome of pulling one track
+type PullTrackStatus struct {
+	RemoteSessionID string `json:"remoteSessionId" doc:"Session that published the track"`
+	TrackName       string `json:"trackName" doc:"Name of the remote track"`
+	Status          string `json:"status" doc:"pulled, not_found when the contract has no such track in the room, or failed"`
+	Mid             string `json:"mid,omitempty" doc:"Transceiver mid of the pulled track in the receiving session"`
+	Error           string `json:"error,omitempty" doc:"Why the track was not pulled"`
+}
+
+// CloseTrackResponse answers a close-track request
+type CloseTrackResponse struct {
+	MessageHeader
+	ResponseEnvelope
+	CloudflareResponse map[string]interface{} `json:"cloudflareResponse" doc:"Cloudflare answer"`
+}
+
+// RenegotiationResponse answers a renegotiation request
+type RenegotiationResponse struct {
+	MessageHeader
+	ResponseEnvelope
+	SessionID          string      `json:"sessionId" doc:"Renegotiated session"`
+	SessionDescription interface{} `json:"sessionDescription,omitempty" doc:"Cloudflare session description"`
+}
+
+// IceRestartResponse answers an ice-restart request
+type IceRestartResponse struct {
+	MessageHeader
+	ResponseEnvelope
+	SessionID          string            `json:"sessionId" doc:"Session to use from now on"`
+	SessionDescription interface{}       `json:"sessionDescription,omitempty" doc:"SDP answer to the restarted offer"`
+	Recreated          bool              `json:"recreated" doc:"Whether the session had expired and was replaced by a new one"`
+	PreviousSessionID  string            `json:"previousSessionId,omitempty" doc:"Expired session, when recreated"`
+	Tracks             []TrackDescriptor `json:"tracks,omitempty" doc:"Tracks republished in the new session, when recreated"`
+}
+
+// DataChannelResponse answers a publish-datachannel or subscribe-datachannel request
+type DataChannelResponse struct {
+	MessageHeader
+	ResponseEnvelope
+	SessionID    string      `json:"sessionId" doc:"Session the channels were opened in"`
+	DataChannels interface{} `json:"dataChannels" doc:"Channels as reported by Cloudflare, with the id to create them with"`
+}
+
+// SetLayerResponse answers a set-layer request
+type SetLayerResponse struct {
+	MessageHeader
+	ResponseEnvelope
+	SessionID                      string      `json:"sessionId" doc:"Session that receives the track"`
+	Mid                            string      `json:"mid" doc:"Transceiver mid of the pulled track"`
+	Rid                            string      `json:"rid" doc:"Simulcast layer now received"`
+	RequiresImmediateRenegotiation bool        `json:"requiresImmediateRenegotiation" doc:"Whether the sender must renegotiate with sessionDescription"`
+	SessionDescription             interface{} `json:"sessionDescription,omitempty" doc:"SDP offer to answer with a renegotiation request"`
+}
+
+// ParticipantLeftNotification tells the remaining participants that someone left
+// and which of its sessions and tracks were closed, so they can drop their pulls
+type ParticipantLeftNotification struct {
+	MessageHeader
+	Participant string   `json:"participant" doc:"Wallet address of the participant that left"`
+	SessionIDs  []string `json:"sessionIds" doc:"Sessions of the participant whose tracks were closed"`
+	TrackNames  []string `json:"trackNames" doc:"Names of the closed tracks"`
+}
+
+// TrackAvailableNotification tells the other participants that tracks were published,
+// with what they need to send a pull-track request for them
+type TrackAvailableNotification struct {
+	MessageHeader
+	Publisher     string           `json:"publisher" doc:"Wallet address of the publisher"`
+	PublisherName string           `json:"publisherName" doc:"Display name of the publisher"`
+	SessionID     string           `json:"sessionId" doc:"Session that published the tracks, the remoteSessionId of a pull"`
+	Tracks        []AvailableTrack `json:"tracks" doc:"Tracks published by one request, announced together"`
+}
+
+// AvailableTrack is one track of a track-available notification
+type AvailableTrack struct {
+	TrackName string   `json:"trackName" doc:"Name of the published track"`
+	Mid       string   `json:"mid" doc:"Transceiver mid of the track in the publisher's session, the channel ID of a data channel"`
+	Location  string   `json:"location,omitempty" doc:"local for media tracks, datachannel for data channels"`
+	Rids      []string `json:"rids,omitempty" doc:"Simulcast layers of the track, for the preferredRid of a pull"`
+}
+
+// SessionClosedNotification tells the owner of a session and the rest of the room that the backend
+// closed the session because it stayed disconnected, so the owner can rejoin and the others drop their pulls
+type SessionClosedNotification struct {
+	MessageHeader
+	Participant string   `json:"participant" doc:"Wallet address of the session owner"`
+	SessionID   string   `json:"sessionId" doc:"Closed session"`
+	TrackNames  []string `json:"trackNames" doc:"Names of the closed tracks"`
+	Reason      string   `json:"reason" doc:"Why the session was closed, disconnected or expired"`
+}
+
+// BroadcastResponse tells the sender of a broadcast request who received the notice
+type BroadcastResponse struct {
+	MessageHeader
+	ResponseEnvelope
+	Recipients []string `json:"recipients" doc:"Participants the notice was delivered to"`
+	Failed     []string `json:"failed,omitempty" doc:"Participants the notice could not be delivered to"`
+}
+
+// BroadcastNotification is a room-wide notice delivered to every participant
+type BroadcastNotification struct {
+	MessageHeader
+	From    string                 `json:"from" doc:"Wallet address of the sender, empty for backend notices"`
+	Event   string                 `json:"event" doc:"Notice name, such as recording-started"`
+	Payload map[string]interface{} `json:"payload,omitempty" doc:"Free-form notice data"`
+}
+
+// ChatSendResponse answers a chat-send request with the stored message
+type ChatSendResponse struct {
+	MessageHeader
+	ResponseEnvelope
+	Chat ChatMessage `json:"chat" doc:"Stored message"`
+}
+
+// ChatHistoryResponse answers a chat-history request
+type ChatHistoryResponse struct {
+	MessageHeader
+	ResponseEnvelope
+	Messages   []ChatMessage `json:"messages" doc:"Messages of the page, oldest first"`
+	HasMore    bool          `json:"hasMore" doc:"Whether older messages remain"`
+	NextBefore int64         `json:"nextBefore,omitempty" doc:"Value of before for the next page"`
+}
+
+// ChatMessageNotification relays a chat message to the other participants
+type ChatMessageNotification struct {
+	MessageHeader
+	Chat ChatMessage `json:"chat" doc:"Relayed message"`
+}
+
+// ErrorResponse reports a failed request. Its type is the response type of the request,
+// such as "pull-track-response", or "error" when the request type is unknown.
+type ErrorResponse struct {
+	MessageHeader
+	ResponseEnvelope
+	ErrorDescription string           `json:"errorDescription" doc:"Deprecated copy of message"`
+	FieldErrors      ValidationErrors `json:"fieldErrors,omitempty" doc:"Fields that failed validation"`
+	SupportedTypes   []string         `json:"supportedTypes,omitempty" doc:"Registered request types, for unsupported types"`
+}
+
+// responseTypeFor returns the response type answering a request type
+func responseTypeFor(requestType string) string {
+	if requestType == "" {
+		return "error"
+	}
+	return requestType + "-response"
+}
+
+// newErrorResponse builds an error response answering a request type
+func newErrorResponse(responseType string, requestType string, requestID string, messageErr *MessageError) ErrorResponse {
+	return ErrorResponse{
+		MessageHeader: responseHeader(responseType, requestID),
+		ResponseEnvelope: ResponseEnvelope{
+			RequestType: requestType,
+			ErrorCode:   messageErr.Code,
+			Message:     messageErr.Message,
+			Retryable:   messageErr.Retryable,
+		},
+		ErrorDescription: messageErr.Message,
+		FieldErrors:      messageErr.Fields,
+	}
+}
+
+// DecodeStrict is a decoder that maps the message payload onto T, rejecting unknown fields
+// and values of the wrong type, then runs the request validation
+func DecodeStrict[T any, PT interface {
+	*T
+	MessageRequest
+}](ctx *MessageContext) (T, error) {
+	var message T
+	payloadBytes, err := json.Marshal(ctx.Payload)
+	if err != nil {
+		return message, err
+	}
+
+	var errs ValidationErrors
+	decodeStrictJSON(payloadBytes, &message, "", &errs)
+	if len(errs) > 0 {
+		return message, errs
+	}
+	if errs = PT(&message).Validate(); len(errs) > 0 {
+		return message, errs
+	}
+	return message, nil
+}
+
+// decodeCompressed inflates "zlib:" compressed data and decodes it strictly into v
+func decodeCompressed(compressedData string, v interface{}, field string, errs *ValidationErrors) error {
+	decompressed, err := inflateEventData([]byte(compressedData))
+	if err != nil {
+		errs.add(field, "%v", err)
+		return err
+	}
+	return decodeStrictJSON(decompressed, v, field, errs)
+}
+
+// decodeStrictJSON decodes JSON into v, turning decoding failures into field errors
+func decodeStrictJSON(data []byte, v interface{}, prefix string, errs *ValidationErrors) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(v)
+	if err == nil {
+		return nil
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &typeErr):
+		errs.add(joinField(prefix, typeErr.Field), "must be %s, got %s", typeErr.Type.String(), typeErr.Value)
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		errs.add(joinField(prefix, field), "unknown field")
+	default:
+		errs.add(prefix, "invalid JSON: %v", err)
+	}
+	return err
+}
+
+// joinField joins a field path onto a prefix
+func joinField(prefix string, field string) string {
+	if prefix == "" {
+		return field
+	}
+	if field == "" {
+		return prefix
+	}
+	return prefix + "." + field
+}
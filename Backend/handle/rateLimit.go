@@ -0,0 +1,312 @@
+package handle
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// RatePolicy allows Requests per Interval on average, with bursts of up to Burst requests.
+// A policy without requests disables the limit.
+type RatePolicy struct {
+	Requests int
+	Interval time.Duration
+	Burst    int
+}
+
+// ParseRatePolicy reads a "<requests>/<interval>" policy such as "20/1m"; empty or "off" disables it
+func ParseRatePolicy(spec string, burst int) (RatePolicy, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" || spec == "off" {
+		return RatePolicy{}, nil
+	}
+
+	countPart, intervalPart, ok := strings.Cut(spec, "/")
+	if !ok {
+		return RatePolicy{}, fmt.Errorf("rate policy %q is not <requests>/<interval>", spec)
+	}
+	requests, err := strconv.Atoi(strings.TrimSpace(countPart))
+	if err != nil || requests < 0 {
+		return RatePolicy{}, fmt.Errorf("invalid request count in rate policy %q", spec)
+	}
+	interval, err := time.ParseDuration(strings.TrimSpace(intervalPart))
+	if err != nil || interval <= 0 {
+		return RatePolicy{}, fmt.Errorf("invalid interval in rate policy %q", spec)
+	}
+	if burst <= 0 {
+		burst = requests
+	}
+	return RatePolicy{Requests: requests, Interval: interval, Burst: burst}, nil
+}
+
+// Enabled reports whether the policy limits anything
+func (p RatePolicy) Enabled() bool {
+	return p.Requests > 0 && p.Interval > 0
+}
+
+// refillTime is how long an empty bucket takes to fill up again
+func (p RatePolicy) refillTime() time.Duration {
+	if !p.Enabled() {
+		return 0
+	}
+	return p.Interval * time.Duration(p.Burst) / time.Duration(p.Requests)
+}
+
+// String formats the policy for logs
+func (p RatePolicy) String() string {
+	if !p.Enabled() {
+		return "off"
+	}
+	return fmt.Sprintf("%d/%s (burst %d)", p.Requests, p.Interval, p.Burst)
+}
+
+// AbusePolicy silently drops a sender's requests for Block once it was throttled
+// Threshold times within Window. A zero threshold never drops.
+type AbusePolicy struct {
+	Threshold int
+	Window    time.Duration
+	Block     time.Duration
+}
+
+// RateLimitConfig holds the policies of a RateLimiter
+type RateLimitConfig struct {
+	Sender RatePolicy
+	Room   RatePolicy
+	Global RatePolicy
+	Abuse  AbusePolicy
+}
+
+// Rate limit decisions
+const (
+	RateAllowed   = "allowed"
+	RateThrottled = "throttled" // answered with a rate_limited error
+	RateDropped   = "dropped"   // ignored without a reply, the sender is blocked for abuse
+)
+
+// tokenBucket refills rate tokens per second up to burst
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// refill adds the tokens earned since the last refill
+func (b *tokenBucket) refill(policy RatePolicy, now time.Time) {
+	rate := float64(policy.Requests) / policy.Interval.Seconds()
+	b.tokens += now.Sub(b.last).Seconds() * rate
+	if b.tokens > float64(policy.Burst) {
+		b.tokens = float64(policy.Burst)
+	}
+	b.last = now
+}
+
+// available reports whether the bucket holds n tokens; a nil bucket is unlimited
+func (b *tokenBucket) available(n int) bool {
+	return b == nil || b.tokens >= float64(n)
+}
+
+// take removes n tokens from the bucket
+func (b *tokenBucket) take(n int) {
+	if b != nil {
+		b.tokens -= float64(n)
+	}
+}
+
+// give puts one token back, up to the burst
+func (b *tokenBucket) give(policy RatePolicy) {
+	if b != nil && b.tokens+1 <= float64(policy.Burst) {
+		b.tokens++
+	}
+}
+
+// capCharge caps an extra charge at the burst less the token of the request itself
+func (p RatePolicy) capCharge(n int) int {
+	if n > p.Burst-1 {
+		n = p.Burst - 1
+	}
+	if n < 0 {
+		n = 0
+	}
+	return n
+}
+
+// senderAbuse tracks how often a sender was throttled
+type senderAbuse struct {
+	throttled    []time.Time
+	blockedUntil time.Time
+}
+
+// RateLimiter applies token bucket limits per sender, per room and globally
+type RateLimiter struct {
+	mu      sync.Mutex
+	config  RateLimitConfig
+	senders map[common.Address]*tokenBucket
+	rooms   map[string]*tokenBucket
+	global  *tokenBucket
+	abuse   map[common.Address]*senderAbuse
+	pruned  time.Time
+	now     func() time.Time
+}
+
+// NewRateLimiter creates a limiter with the given policies
+func NewRateLimiter(config RateLimitConfig) *RateLimiter {
+	return &RateLimiter{
+		config:  config,
+		senders: make(map[common.Address]*tokenBucket),
+		rooms:   make(map[string]*tokenBucket),
+		abuse:   make(map[common.Address]*senderAbuse),
+		now:     time.Now,
+	}
+}
+
+// Allow decides whether a request from sender in room may be handled. All buckets are checked
+// before any token is taken, so a refused request costs nothing. Only refusals by the sender's own
+// bucket count as abuse; a busy room or backend throttles without blocking its senders.
+func (l *RateLimiter) Allow(roomID string, sender common.Address) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.prune(now)
+
+	abuse := l.abuse[sender]
+	if abuse != nil && now.Before(abuse.blockedUntil) {
+		return RateDropped
+	}
+
+	senderBucket := refillBucket(l.senders, sender, l.config.Sender, now)
+	roomBucket := refillBucket(l.rooms, roomID, l.config.Room, now)
+	globalBucket := l.refillGlobal(now)
+	if !senderBucket.available(1) {
+		return l.throttleSender(sender, abuse, now)
+	}
+	if !roomBucket.available(1) || !globalBucket.available(1) {
+		return RateThrottled
+	}
+
+	senderBucket.take(1)
+	roomBucket.take(1)
+	globalBucket.take(1)
+	return RateAllowed
+}
+
+// Charge takes n more tokens for a request Allow already let through, such as one sending a
+// transaction per participant. The charge is capped at what a full bucket holds besides the
+// request's own token, so large requests drain the bucket instead of never fitting. Refusals
+// do not count as abuse.
+func (l *RateLimiter) Charge(roomID string, sender common.Address, n int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	buckets := []*tokenBucket{
+		refillBucket(l.senders, sender, l.config.Sender, now),
+		refillBucket(l.rooms, roomID, l.config.Room, now),
+		l.refillGlobal(now),
+	}
+	policies := []RatePolicy{l.config.Sender, l.config.Room, l.config.Global}
+	for i, bucket := range buckets {
+		if !bucket.available(policies[i].capCharge(n)) {
+			return false
+		}
+	}
+	for i, bucket := range buckets {
+		bucket.take(policies[i].capCharge(n))
+	}
+	return true
+}
+
+// Refund returns a token taken by Allow for a request that was not handled after all
+func (l *RateLimiter) Refund(roomID string, sender common.Address) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	refillBucket(l.senders, sender, l.config.Sender, now).give(l.config.Sender)
+	refillBucket(l.rooms, roomID, l.config.Room, now).give(l.config.Room)
+	l.refillGlobal(now).give(l.config.Global)
+}
+
+// throttleSender records that a sender ran out of tokens and blocks it once the abuse threshold is reached
+func (l *RateLimiter) throttleSender(sender common.Address, abuse *senderAbuse, now time.Time) string {
+	if l.config.Abuse.Threshold <= 0 {
+		return RateThrottled
+	}
+	if abuse == nil {
+		abuse = &senderAbuse{}
+		l.abuse[sender] = abuse
+	}
+	abuse.throttled = append(recentTimes(abuse.throttled, now.Add(-l.config.Abuse.Window)), now)
+	if len(abuse.throttled) >= l.config.Abuse.Threshold {
+		abuse.throttled = nil
+		abuse.blockedUntil = now.Add(l.config.Abuse.Block)
+		log.Printf("[RateLimit] Sender %s throttled %d times within %s, dropping its requests for %s",
+			sender.Hex(), l.config.Abuse.Threshold, l.config.Abuse.Window, l.config.Abuse.Block)
+		return RateDropped
+	}
+	return RateThrottled
+}
+
+// refillBucket refills the bucket of key, creating a full bucket for new keys.
+// It returns nil when the policy is disabled.
+func refillBucket[K comparable](buckets map[K]*tokenBucket, key K, policy RatePolicy, now time.Time) *tokenBucket {
+	if !policy.Enabled() {
+		return nil
+	}
+	bucket, ok := buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(policy.Burst), last: now}
+		buckets[key] = bucket
+	}
+	bucket.refill(policy, now)
+	return bucket
+}
+
+// refillGlobal refills the global bucket, nil when the global policy is disabled
+func (l *RateLimiter) refillGlobal(now time.Time) *tokenBucket {
+	if !l.config.Global.Enabled() {
+		return nil
+	}
+	if l.global == nil {
+		l.global = &tokenBucket{tokens: float64(l.config.Global.Burst), last: now}
+	}
+	l.global.refill(l.config.Global, now)
+	return l.global
+}
+
+// prune forgets idle buckets and expired abuse records once a minute
+func (l *RateLimiter) prune(now time.Time) {
+	if now.Sub(l.pruned) < time.Minute {
+		return
+	}
+	l.pruned = now
+
+	for sender, bucket := range l.senders {
+		if now.Sub(bucket.last) > l.config.Sender.refillTime() {
+			delete(l.senders, sender)
+		}
+	}
+	for roomID, bucket := range l.rooms {
+		if now.Sub(bucket.last) > l.config.Room.refillTime() {
+			delete(l.rooms, roomID)
+		}
+	}
+	for sender, abuse := range l.abuse {
+		abuse.throttled = recentTimes(abuse.throttled, now.Add(-l.config.Abuse.Window))
+		if len(abuse.throttled) == 0 && now.After(abuse.blockedUntil) {
+			delete(l.abuse, sender)
+		}
+	}
+}
+
+// recentTimes drops the times before since
+func recentTimes(times []time.Time, since time.Time) []time.Time {
+	for len(times) > 0 && times[0].Before(since) {
+		times = times[1:]
+	}
+	return times
+}
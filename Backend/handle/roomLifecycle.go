@@ -0,0 +1,303 @@
+package handle
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	contract "dappmeetingnew/constract"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+)
+
+// Meeting states
+const (
+	MeetingActive = "active"
+	MeetingIdle   = "idle"
+	MeetingEnded  = "ended"
+)
+
+// meetingSchema creates the meeting table, one row per active period of a room
+var meetingSchema = []string{
+	`CREATE TABLE IF NOT EXISTS meetings (
+		id                INTEGER PRIMARY KEY AUTOINCREMENT,
+		room_id           TEXT    NOT NULL,
+		status            TEXT    NOT NULL,
+		started_at        INTEGER NOT NULL,
+		idle_since        INTEGER NOT NULL DEFAULT 0,
+		ended_at          INTEGER NOT NULL DEFAULT 0,
+		participants      INTEGER NOT NULL DEFAULT 0,
+		peak_participants INTEGER NOT NULL DEFAULT 0,
+		sessions_closed   INTEGER NOT NULL DEFAULT 0
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_meetings_room_status ON meetings (room_id, status)`,
+}
+
+// MeetingRecord describes one meeting of a room, from its first join until it ended
+type MeetingRecord struct {
+	ID               int64     `json:"id"`
+	RoomID           string    `json:"roomId"`
+	Status           string    `json:"status"`
+	StartedAt        time.Time `json:"startedAt"`
+	IdleSince        time.Time `json:"idleSince,omitempty"`
+	EndedAt          time.Time `json:"endedAt,omitempty"`
+	DurationSeconds  int64     `json:"durationSeconds"` // from the first join until the room emptied
+	Participants     int       `json:"participants"`
+	PeakParticipants int       `json:"peakParticipants"`
+	SessionsClosed   int       `json:"sessionsClosed"`
+}
+
+// RoomLifecycle marks rooms active on their first join and idle once the last participant left.
+// Rooms idle for longer than the grace period are ended: their Cloudflare sessions are closed
+// and a meeting-ended record is emitted.
+type RoomLifecycle struct {
+	db                *sql.DB
+	contractInstance  *contract.Contract
+	cloudflareService *CloudflareService
+	sessions          *SessionRegistry
+	grace             time.Duration
+	onEnded           func(MeetingRecord)
+	mu                sync.Mutex
+}
+
+// NewRoomLifecycle creates the lifecycle tracker on the shared database
+func NewRoomLifecycle(db *sql.DB, contractInstance *contract.Contract, cloudflareService *CloudflareService,
+	sessions *SessionRegistry, grace time.Duration) (*RoomLifecycle, error) {
+	if err := migrate(db, meetingSchema); err != nil {
+		return nil, err
+	}
+	return &RoomLifecycle{
+		db:                db,
+		contractInstance:  contractInstance,
+		cloudflareService: cloudflareService,
+		sessions:          sessions,
+		grace:             grace,
+	}, nil
+}
+
+// OnMeetingEnded sets the function receiving every meeting-ended record
+func (l *RoomLifecycle) OnMeetingEnded(onEnded func(MeetingRecord)) {
+	l.onEnded = onEnded
+}
+
+// ParticipantJoined starts a meeting on the first join, or wakes an idle one, and tracks the peak
+func (l *RoomLifecycle) ParticipantJoined(roomID string) error {
+	count, err := l.participantCount(roomID)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	meeting, ok, err := l.current(roomID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		_, err = l.db.Exec(`INSERT INTO meetings (room_id, status, started_at, participants, peak_participants) VALUES (?, ?, ?, ?, ?)`,
+			roomID, MeetingActive, time.Now().Unix(), count, count)
+		if err != nil {
+			return fmt.Errorf("error starting meeting of room %s: %v", roomID, err)
+		}
+		log.Printf("[Lifecycle] Meeting started in room %s", roomID)
+		return nil
+	}
+
+	if meeting.Status == MeetingIdle {
+		log.Printf("[Lifecycle] Room %s is active again", roomID)
+	}
+	_, err = l.db.Exec(`UPDATE meetings SET status = ?, idle_since = 0, participants = ?, peak_participants = MAX(peak_participants, ?) WHERE id = ?`,
+		MeetingActive, count, count, meeting.ID)
+	if err != nil {
+		return fmt.Errorf("error updating meeting of room %s: %v", roomID, err)
+	}
+	return nil
+}
+
+// ParticipantLeft marks the meeting idle once the room is empty
+func (l *RoomLifecycle) ParticipantLeft(roomID string) error {
+	count, err := l.participantCount(roomID)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	meeting, ok, err := l.current(roomID)
+	if err != nil || !ok {
+		return err
+	}
+
+	status, idleSince := MeetingActive, int64(0)
+	if count == 0 {
+		status, idleSince = MeetingIdle, time.Now().Unix()
+		log.Printf("[Lifecycle] Room %s is empty, ending its meeting in %s", roomID, l.grace)
+	}
+	_, err = l.db.Exec(`UPDATE meetings SET status = ?, idle_since = ?, participants = ? WHERE id = ?`,
+		status, idleSince, count, meeting.ID)
+	if err != nil {
+		return fmt.Errorf("error updating meeting of room %s: %v", roomID, err)
+	}
+	return nil
+}
+
+// Run ends idle meetings past the grace period until ctx is canceled
+func (l *RoomLifecycle) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			l.EndIdleMeetings()
+		}
+	}
+}
+
+// EndIdleMeetings ends the meetings that stayed idle for the grace period
+func (l *RoomLifecycle) EndIdleMeetings() {
+	deadline := time.Now().Add(-l.grace).Unix()
+	meetings, err := l.query(`WHERE status = ? AND idle_since <= ? ORDER BY id`, MeetingIdle, deadline)
+	if err != nil {
+		log.Printf("[Lifecycle] Error listing idle meetings: %v", err)
+		return
+	}
+
+	for _, meeting := range meetings {
+		// Someone may have joined while the event was missed
+		count, err := l.participantCount(meeting.RoomID)
+		if err != nil {
+			log.Printf("[Lifecycle] %v", err)
+			continue
+		}
+		if count > 0 {
+			if err := l.ParticipantJoined(meeting.RoomID); err != nil {
+				log.Printf("[Lifecycle] %v", err)
+			}
+			continue
+		}
+
+		if err := l.end(meeting); err != nil {
+			log.Printf("[Lifecycle] Error ending meeting of room %s: %v", meeting.RoomID, err)
+		}
+	}
+}
+
+// end closes the room's sessions and records the end of the meeting. Only sessions created before the
+// room went idle are closed, so a participant joining meanwhile keeps the session it just got.
+func (l *RoomLifecycle) end(meeting MeetingRecord) error {
+	closed := 0
+	if l.sessions != nil {
+		sessionIDs, err := l.sessions.RoomSessions(meeting.RoomID, meeting.IdleSince)
+		if err != nil {
+			return fmt.Errorf("error listing sessions: %v", err)
+		}
+		for _, sessionID := range sessionIDs {
+			trackNames, err := l.cloudflareService.CloseLocalTracks(sessionID)
+			if err != nil {
+				log.Printf("[Lifecycle] Error closing session %s of room %s: %v", sessionID, meeting.RoomID, err)
+				continue
+			}
+			if err := l.sessions.Remove(sessionID); err != nil {
+				log.Printf("[Lifecycle] %v", err)
+			}
+			// Sessions without live tracks had nothing left to close
+			if len(trackNames) > 0 {
+				closed++
+			}
+		}
+	}
+
+	l.mu.Lock()
+	endedAt := time.Now()
+	result, err := l.db.Exec(`UPDATE meetings SET status = ?, ended_at = ?, participants = 0, sessions_closed = ? WHERE id = ? AND status = ?`,
+		MeetingEnded, endedAt.Unix(), closed, meeting.ID, MeetingIdle)
+	l.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if count, _ := result.RowsAffected(); count == 0 {
+		// A participant joined while the sessions were closed
+		return nil
+	}
+
+	meeting.Status = MeetingEnded
+	meeting.EndedAt = endedAt.UTC()
+	meeting.DurationSeconds = int64(meeting.IdleSince.Sub(meeting.StartedAt).Seconds())
+	meeting.Participants = 0
+	meeting.SessionsClosed = closed
+	log.Printf("[Lifecycle] Meeting ended in room %s after %ds, peak %d participants, %d sessions closed",
+		meeting.RoomID, meeting.DurationSeconds, meeting.PeakParticipants, closed)
+
+	if l.onEnded != nil {
+		l.onEnded(meeting)
+	}
+	return nil
+}
+
+// Meetings lists the meetings of a room, newest first; an empty room lists all rooms
+func (l *RoomLifecycle) Meetings(roomID string, limit int) ([]MeetingRecord, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+	if roomID == "" {
+		return l.query(`ORDER BY id DESC LIMIT ?`, limit)
+	}
+	return l.query(`WHERE room_id = ? ORDER BY id DESC LIMIT ?`, roomID, limit)
+}
+
+// current returns the meeting of a room that has not ended
+func (l *RoomLifecycle) current(roomID string) (MeetingRecord, bool, error) {
+	meetings, err := l.query(`WHERE room_id = ? AND status != ? ORDER BY id DESC LIMIT 1`, roomID, MeetingEnded)
+	if err != nil || len(meetings) == 0 {
+		return MeetingRecord{}, false, err
+	}
+	return meetings[0], true, nil
+}
+
+// participantCount reads the number of participants in a room from the contract
+func (l *RoomLifecycle) participantCount(roomID string) (int, error) {
+	opts := &bind.CallOpts{Context: context.Background()}
+	count, err := l.contractInstance.GetRoomParticipantsCount(opts, roomID)
+	if err != nil {
+		return 0, fmt.Errorf("error reading participant count of room %s: %v", roomID, err)
+	}
+	return int(count.Int64()), nil
+}
+
+// query reads meetings matching the SQL suffix
+func (l *RoomLifecycle) query(suffix string, args ...interface{}) ([]MeetingRecord, error) {
+	rows, err := l.db.Query(`SELECT id, room_id, status, started_at, idle_since, ended_at, participants,
+		peak_participants, sessions_closed FROM meetings `+suffix, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var meetings []MeetingRecord
+	for rows.Next() {
+		var meeting MeetingRecord
+		var startedAt, idleSince, endedAt int64
+		if err := rows.Scan(&meeting.ID, &meeting.RoomID, &meeting.Status, &startedAt, &idleSince, &endedAt,
+			&meeting.Participants, &meeting.PeakParticipants, &meeting.SessionsClosed); err != nil {
+			return nil, err
+		}
+		meeting.StartedAt = time.Unix(startedAt, 0).UTC()
+		if idleSince > 0 {
+			meeting.IdleSince = time.Unix(idleSince, 0).UTC()
+		}
+		if endedAt > 0 {
+			meeting.EndedAt = time.Unix(endedAt, 0).UTC()
+			meeting.DurationSeconds = idleSince - startedAt
+		}
+		meetings = append(meetings, meeting)
+	}
+	return meetings, rows.Err()
+}
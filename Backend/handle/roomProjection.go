@@ -0,0 +1,379 @@
+package handle
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	contract "dappmeetingnew/constract"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// ParticipantState is the projected state of one participant in a room
+type ParticipantState struct {
+	Address      common.Address              `json:"address"`
+	Name         string                      `json:"name"`
+	SessionID    string                      `json:"sessionId"`
+	Sessions     []string                    `json:"sessions"`
+	Tracks       []contract.DAppMeetingTrack `json:"tracks"`
+	JoinedBlock  uint64                      `json:"joinedBlock,omitempty"`
+	LastActivity time.Time                   `json:"lastActivity"`
+}
+
+// RoomState is the projected state of a room
+type RoomState struct {
+	RoomID       string             `json:"roomId"`
+	Participants []ParticipantState `json:"participants"`
+	LastBlock    uint64             `json:"lastBlock"`
+}
+
+// roomProjectionState holds the mutable state of one projected room
+type roomProjectionState struct {
+	participants map[common.Address]*ParticipantState
+	lastBlock    uint64
+}
+
+// RoomProjection builds room, participant, session and track state from the contract
+// event streams, so questions about a room can be answered without RPC round-trips
+type RoomProjection struct {
+	client           *ethclient.Client
+	contractInstance *contract.Contract
+	rooms            map[string]*roomProjectionState
+	mu               sync.RWMutex
+}
+
+// NewRoomProjection creates an empty projection that seeds rooms from the contract views
+// and reads the names of joining participants from their joinRoom transactions
+func NewRoomProjection(client *ethclient.Client, contractInstance *contract.Contract) *RoomProjection {
+	return &RoomProjection{
+		client:           client,
+		contractInstance: contractInstance,
+		rooms:            make(map[string]*roomProjectionState),
+	}
+}
+
+// Seed loads the current state of the given rooms from the contract
+func (p *RoomProjection) Seed(roomIDs []string) error {
+	for _, roomID := range roomIDs {
+		if err := p.seedRoom(roomID); err != nil {
+			return fmt.Errorf("failed to seed room %s: %v", roomID, err)
+		}
+	}
+	return nil
+}
+
+// seedRoom replaces the projected state of a room with the contract view
+func (p *RoomProjection) seedRoom(roomID string) error {
+	opts := &bind.CallOpts{Context: context.Background()}
+	details, err := p.contractInstance.GetRoomParticipantsDetails(opts, roomID)
+	if err != nil {
+		return err
+	}
+
+	room := &roomProjectionState{participants: make(map[common.Address]*ParticipantState)}
+	now := time.Now()
+	for _, detail := range details {
+		participant := &ParticipantState{
+			Address:      detail.WalletAddress,
+			Name:         detail.Name,
+			SessionID:    detail.SessionID,
+			Tracks:       detail.Tracks,
+			LastActivity: now,
+		}
+		if detail.SessionID != "" {
+			participant.Sessions = []string{detail.SessionID}
+		}
+		room.participants[detail.WalletAddress] = participant
+	}
+
+	p.mu.Lock()
+	if existing, ok := p.rooms[roomID]; ok {
+		room.lastBlock = existing.lastBlock
+	}
+	p.rooms[roomID] = room
+	p.mu.Unlock()
+
+	log.Printf("[Projection] Seeded room %s with %d participants", roomID, len(details))
+	return nil
+}
+
+// ensureRoom seeds a room the first time an event mentions it and reports whether the room is known.
+// A room whose seed failed stays unknown, so the next event retries the seed instead of building on
+// an empty room.
+func (p *RoomProjection) ensureRoom(roomID string) bool {
+	p.mu.RLock()
+	_, ok := p.rooms[roomID]
+	p.mu.RUnlock()
+	if ok {
+		return true
+	}
+
+	if err := p.seedRoom(roomID); err != nil {
+		log.Printf("[Projection] Error seeding room %s: %v", roomID, err)
+		return false
+	}
+	return true
+}
+
+// participantLocked returns the participant, creating it if needed; p.mu must be held
+func (p *RoomProjection) participantLocked(roomID string, address common.Address) *ParticipantState {
+	room := p.rooms[roomID]
+	participant, ok := room.participants[address]
+	if !ok {
+		participant = &ParticipantState{Address: address}
+		room.participants[address] = participant
+	}
+	participant.LastActivity = time.Now()
+	return participant
+}
+
+// knownParticipantLocked returns a participant the projection already knows, nil otherwise; p.mu must be held
+func (p *RoomProjection) knownParticipantLocked(roomID string, address common.Address) *ParticipantState {
+	participant, ok := p.rooms[roomID].participants[address]
+	if !ok {
+		return nil
+	}
+	participant.LastActivity = time.Now()
+	return participant
+}
+
+// ApplyParticipantJoined adds the participant and its initial tracks. The name comes from the seed
+// of the room, or else from the joinRoom transaction that emitted the event.
+func (p *RoomProjection) ApplyParticipantJoined(event *contract.ContractParticipantJoined) {
+	if !p.ensureRoom(event.RoomId) {
+		return
+	}
+
+	p.mu.RLock()
+	existing, known := p.rooms[event.RoomId].participants[event.Participant]
+	needsName := !known || existing.Name == ""
+	p.mu.RUnlock()
+
+	var name string
+	if needsName {
+		var err error
+		if name, err = joinRoomName(p.client, event.Raw.TxHash); err != nil {
+			log.Printf("[Projection] Error reading name of %s: %v", event.Participant.Hex(), err)
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	participant := p.participantLocked(event.RoomId, event.Participant)
+	if name != "" {
+		participant.Name = name
+	}
+	participant.JoinedBlock = event.Raw.BlockNumber
+	participant.Tracks = append([]contract.DAppMeetingTrack(nil), event.InitialTracks...)
+	p.rooms[event.RoomId].lastBlock = event.Raw.BlockNumber
+}
+
+// ApplyParticipantLeft removes the participant; the contract deletes its tracks too
+func (p *RoomProjection) ApplyParticipantLeft(event *contract.ContractParticipantLeft) {
+	if !p.ensureRoom(event.RoomId) {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	room := p.rooms[event.RoomId]
+	delete(room.participants, event.Participant)
+	room.lastBlock = event.Raw.BlockNumber
+}
+
+// ApplyTrackAdded records a new track from the event. TrackAdded carries no mid or location;
+// those of tracks the backend added itself come from RecordTrack.
+func (p *RoomProjection) ApplyTrackAdded(event *contract.ContractTrackAdded) {
+	if !p.ensureRoom(event.RoomId) {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.rooms[event.RoomId].lastBlock = event.Raw.BlockNumber
+	participant := p.knownParticipantLocked(event.RoomId, event.Participant)
+	if participant == nil {
+		return
+	}
+	participant.upsertTrack(contract.DAppMeetingTrack{
+		TrackName:   event.TrackName,
+		SessionId:   event.SessionId,
+		RoomId:      event.RoomId,
+		IsPublished: true,
+	})
+}
+
+// RecordTrack records a track the backend added to the contract, with the mid and location
+// its TrackAdded event leaves out. The event may be applied before or after it.
+func (p *RoomProjection) RecordTrack(roomID string, participant common.Address, track contract.DAppMeetingTrack) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, ok := p.rooms[roomID]; !ok {
+		return
+	}
+	p.participantLocked(roomID, participant).upsertTrack(track)
+}
+
+// upsertTrack adds a track, or fills in the fields a known track with the same name and session lacks
+func (ps *ParticipantState) upsertTrack(track contract.DAppMeetingTrack) {
+	for i := range ps.Tracks {
+		existing := &ps.Tracks[i]
+		if existing.TrackName != track.TrackName || existing.SessionId != track.SessionId {
+			continue
+		}
+		if existing.Mid == "" {
+			existing.Mid = track.Mid
+		}
+		if existing.Location == "" {
+			existing.Location = track.Location
+		}
+		if existing.RoomId == "" {
+			existing.RoomId = track.RoomId
+		}
+		existing.IsPublished = existing.IsPublished || track.IsPublished
+		return
+	}
+	ps.Tracks = append(ps.Tracks, track)
+}
+
+// ApplyEventToBackend records the sessions a known participant refers to in its requests. Senders
+// the projection does not know are left out rather than added without a join.
+func (p *RoomProjection) ApplyEventToBackend(event *contract.ContractEventForwardedToBackend) {
+	if !p.ensureRoom(event.RoomId) {
+		return
+	}
+
+	// Requests that cannot be decoded still count as participant activity
+	eventData, _ := decodeEventData(event.EventData)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.rooms[event.RoomId].lastBlock = event.Raw.BlockNumber
+	participant := p.knownParticipantLocked(event.RoomId, event.Sender)
+	if participant == nil {
+		return
+	}
+	if sessionID, ok := eventData["sessionId"].(string); ok {
+		participant.addSession(sessionID)
+	}
+}
+
+// ApplyEventToFrontend records the sessions the backend assigned in its responses
+func (p *RoomProjection) ApplyEventToFrontend(event *contract.ContractEventForwardedToFrontend) {
+	if !p.ensureRoom(event.RoomId) {
+		return
+	}
+
+	eventData, err := decodeEventData(event.EventData)
+	if err != nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.rooms[event.RoomId].lastBlock = event.Raw.BlockNumber
+	participant, ok := p.rooms[event.RoomId].participants[event.Participant]
+	if !ok {
+		return
+	}
+
+	sessionID, _ := eventData["sessionID"].(string)
+	if sessionID == "" {
+		sessionID, _ = eventData["sessionId"].(string)
+	}
+	if sessionID == "" {
+		return
+	}
+
+	// join-room assigns the participant's main session, which the backend also stores on-chain
+	if eventType, _ := eventData["type"].(string); eventType == "join-room" {
+		participant.SessionID = sessionID
+	}
+	participant.addSession(sessionID)
+}
+
+// addSession remembers a session ID used by the participant
+func (ps *ParticipantState) addSession(sessionID string) {
+	if sessionID == "" {
+		return
+	}
+	for _, existing := range ps.Sessions {
+		if existing == sessionID {
+			return
+		}
+	}
+	ps.Sessions = append(ps.Sessions, sessionID)
+}
+
+// copy returns a deep copy that is safe to hand out
+func (ps *ParticipantState) copy() ParticipantState {
+	cp := *ps
+	cp.Sessions = append([]string(nil), ps.Sessions...)
+	cp.Tracks = append([]contract.DAppMeetingTrack(nil), ps.Tracks...)
+	return cp
+}
+
+// Rooms returns the IDs of all projected rooms
+func (p *RoomProjection) Rooms() []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	roomIDs := make([]string, 0, len(p.rooms))
+	for roomID := range p.rooms {
+		roomIDs = append(roomIDs, roomID)
+	}
+	sort.Strings(roomIDs)
+	return roomIDs
+}
+
+// Room returns a snapshot of a projected room
+func (p *RoomProjection) Room(roomID string) (RoomState, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	room, ok := p.rooms[roomID]
+	if !ok {
+		return RoomState{}, false
+	}
+
+	state := RoomState{
+		RoomID:       roomID,
+		Participants: make([]ParticipantState, 0, len(room.participants)),
+		LastBlock:    room.lastBlock,
+	}
+	for _, participant := range room.participants {
+		state.Participants = append(state.Participants, participant.copy())
+	}
+	sort.Slice(state.Participants, func(i, j int) bool {
+		return state.Participants[i].Address.Hex() < state.Participants[j].Address.Hex()
+	})
+	return state, true
+}
+
+// Participant returns a snapshot of one participant in a projected room
+func (p *RoomProjection) Participant(roomID string, address common.Address) (ParticipantState, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	room, ok := p.rooms[roomID]
+	if !ok {
+		return ParticipantState{}, false
+	}
+	participant, ok := room.participants[address]
+	if !ok {
+		return ParticipantState{}, false
+	}
+	return participant.copy(), true
+}
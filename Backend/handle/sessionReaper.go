@@ -0,0 +1,210 @@
+package handle
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+)
+
+// SessionReaper polls the state of every session the backend created and closes
+// the ones that stayed disconnected for longer than the threshold
+type SessionReaper struct {
+	cloudflareService *CloudflareService
+	sessions          *SessionRegistry
+	threshold         time.Duration
+	onReaped          func(owner SessionOwner, trackNames []string, reason string)
+
+	mu                sync.Mutex
+	disconnectedSince map[string]time.Time
+	tracked           int
+	polls             uint64
+	pollErrors        uint64
+	reaped            uint64
+	expired           uint64
+	reapErrors        uint64
+}
+
+// NewSessionReaper creates a reaper closing sessions disconnected for longer than threshold
+func NewSessionReaper(cloudflareService *CloudflareService, sessions *SessionRegistry, threshold time.Duration) *SessionReaper {
+	return &SessionReaper{
+		cloudflareService: cloudflareService,
+		sessions:          sessions,
+		threshold:         threshold,
+		disconnectedSince: make(map[string]time.Time),
+	}
+}
+
+// OnReaped sets the function called after a stale session was closed, with the reason
+// disconnected, or expired when Cloudflare had already forgotten it. It runs on its own
+// goroutine, so the transactions it sends do not hold up the poll.
+func (r *SessionReaper) OnReaped(onReaped func(owner SessionOwner, trackNames []string, reason string)) {
+	r.onReaped = onReaped
+}
+
+// Run polls the sessions every interval until ctx is canceled
+func (r *SessionReaper) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.Poll()
+		}
+	}
+}
+
+// Poll checks every registered session once and reaps the stale ones
+func (r *SessionReaper) Poll() {
+	owners, err := r.sessions.All()
+	if err != nil {
+		log.Printf("[Reaper] Error listing sessions: %v", err)
+		return
+	}
+
+	now := time.Now()
+	tracked := len(owners)
+	seen := make(map[string]bool, len(owners))
+	for _, owner := range owners {
+		seen[owner.SessionID] = true
+
+		state, err := r.cloudflareService.GetSessionState(owner.SessionID)
+		if err != nil {
+			// Sessions of crashed browsers expire on Cloudflare; forget them instead of polling them forever
+			if sessionGone(err) {
+				r.forget(owner)
+				tracked--
+				continue
+			}
+		}
+		r.mu.Lock()
+		r.polls++
+		if err != nil {
+			r.pollErrors++
+		}
+		r.mu.Unlock()
+		if err != nil {
+			log.Printf("[Reaper] Error reading state of session %s: %v", owner.SessionID, err)
+			continue
+		}
+
+		if connected, known := sessionConnected(state); connected || !known {
+			r.mu.Lock()
+			delete(r.disconnectedSince, owner.SessionID)
+			r.mu.Unlock()
+			continue
+		}
+
+		r.mu.Lock()
+		since, ok := r.disconnectedSince[owner.SessionID]
+		if !ok {
+			since = now
+			r.disconnectedSince[owner.SessionID] = now
+		}
+		r.mu.Unlock()
+
+		if now.Sub(since) >= r.threshold && r.reap(owner, now.Sub(since)) {
+			tracked--
+		}
+	}
+
+	// Forget sessions that were removed elsewhere, such as on leave
+	r.mu.Lock()
+	for sessionID := range r.disconnectedSince {
+		if !seen[sessionID] {
+			delete(r.disconnectedSince, sessionID)
+		}
+	}
+	r.tracked = tracked
+	r.mu.Unlock()
+}
+
+// sessionConnected reports whether a session state shows a live connection, and whether that is known.
+// Cloudflare reports no connection state, so a session is connected when one of its tracks is active
+// and disconnected when all of them are inactive. A session without tracks, such as the session of a
+// participant alone in a room, tells nothing about its connection.
+func sessionConnected(state map[string]interface{}) (bool, bool) {
+	if connectionState, ok := state["connectionState"].(string); ok && connectionState != "" {
+		return connectionState == "connected", true
+	}
+
+	tracks, _ := state["tracks"].([]interface{})
+	for _, stateTrack := range tracks {
+		if track, ok := stateTrack.(map[string]interface{}); ok && track["status"] == "active" {
+			return true, true
+		}
+	}
+	return false, len(tracks) > 0
+}
+
+// reap closes a stale session and forgets it, reporting whether it was closed
+func (r *SessionReaper) reap(owner SessionOwner, disconnectedFor time.Duration) bool {
+	log.Printf("[Reaper] Session %s of %s in room %s disconnected for %s, closing it",
+		owner.SessionID, owner.Participant.Hex(), owner.RoomID, disconnectedFor.Round(time.Second))
+
+	trackNames, err := r.cloudflareService.CloseLocalTracks(owner.SessionID)
+	if err != nil {
+		log.Printf("[Reaper] %v", err)
+		r.mu.Lock()
+		r.reapErrors++
+		r.mu.Unlock()
+		return false
+	}
+	if err := r.sessions.Remove(owner.SessionID); err != nil {
+		log.Printf("[Reaper] %v", err)
+	}
+
+	r.mu.Lock()
+	r.reaped++
+	delete(r.disconnectedSince, owner.SessionID)
+	r.mu.Unlock()
+
+	if r.onReaped != nil {
+		go r.onReaped(owner, trackNames, "disconnected")
+	}
+	return true
+}
+
+// forget removes a session Cloudflare no longer knows from the registry and reports it
+func (r *SessionReaper) forget(owner SessionOwner) {
+	log.Printf("[Reaper] Session %s of %s in room %s expired on Cloudflare, forgetting it",
+		owner.SessionID, owner.Participant.Hex(), owner.RoomID)
+
+	if err := r.sessions.Remove(owner.SessionID); err != nil {
+		log.Printf("[Reaper] %v", err)
+	}
+
+	r.mu.Lock()
+	r.polls++
+	r.expired++
+	delete(r.disconnectedSince, owner.SessionID)
+	r.mu.Unlock()
+
+	if r.onReaped != nil {
+		go r.onReaped(owner, nil, "expired")
+	}
+}
+
+// WriteMetrics writes the reaper counters in the Prometheus text format
+func (r *SessionReaper) WriteMetrics(w io.Writer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	writeMetric(w, "meeting_sessions_tracked", "gauge", "Sessions created by the backend that are still registered", float64(r.tracked))
+	writeMetric(w, "meeting_sessions_disconnected", "gauge", "Registered sessions currently seen disconnected", float64(len(r.disconnectedSince)))
+	writeMetric(w, "meeting_session_polls_total", "counter", "Session state polls", float64(r.polls))
+	writeMetric(w, "meeting_session_poll_errors_total", "counter", "Session state polls that failed", float64(r.pollErrors))
+	writeMetric(w, "meeting_sessions_reaped_total", "counter", "Stale sessions closed by the reaper", float64(r.reaped))
+	writeMetric(w, "meeting_sessions_expired_total", "counter", "Sessions forgotten because Cloudflare had expired them", float64(r.expired))
+	writeMetric(w, "meeting_session_reap_errors_total", "counter", "Stale sessions the reaper failed to close", float64(r.reapErrors))
+}
+
+// writeMetric writes one metric with its help and type lines
+func writeMetric(w io.Writer, name string, metricType string, help string, value float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %g\n", name, help, name, metricType, name, value)
+}
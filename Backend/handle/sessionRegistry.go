@@ -0,0 +1,222 @@
+package handle
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	contract "dappmeetingnew/constract"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// sessionRegistrySchema creates the table of Cloudflare sessions created by the backend
+var sessionRegistrySchema = []string{
+	`CREATE TABLE IF NOT EXISTS session_owners (
+		session_id  TEXT    PRIMARY KEY,
+		room_id     TEXT    NOT NULL,
+		participant TEXT    NOT NULL,
+		created_at  INTEGER NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_session_owners_participant ON session_owners (room_id, participant)`,
+}
+
+// SessionOwner is the room and participant a Cloudflare session was created for
+type SessionOwner struct {
+	SessionID   string         `json:"sessionId"`
+	RoomID      string         `json:"roomId"`
+	Participant common.Address `json:"participant"`
+	CreatedAt   time.Time      `json:"createdAt"`
+}
+
+// SessionRegistry is the authoritative map of Cloudflare sessions to their room and participant
+type SessionRegistry struct {
+	db               *sql.DB
+	contractInstance *contract.Contract
+}
+
+// NewSessionRegistry creates the registry on the shared database
+func NewSessionRegistry(db *sql.DB, contractInstance *contract.Contract) (*SessionRegistry, error) {
+	if err := migrate(db, sessionRegistrySchema); err != nil {
+		return nil, err
+	}
+	return &SessionRegistry{db: db, contractInstance: contractInstance}, nil
+}
+
+// Record registers a session created for a participant
+func (r *SessionRegistry) Record(sessionID string, roomID string, participant common.Address) error {
+	_, err := r.db.Exec(`INSERT OR REPLACE INTO session_owners (session_id, room_id, participant, created_at) VALUES (?, ?, ?, ?)`,
+		sessionID, roomID, participant.Hex(), time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("error recording session %s: %v", sessionID, err)
+	}
+	return nil
+}
+
+// Remove forgets a session that was torn down
+func (r *SessionRegistry) Remove(sessionID string) error {
+	if _, err := r.db.Exec(`DELETE FROM session_owners WHERE session_id = ?`, sessionID); err != nil {
+		return fmt.Errorf("error removing session %s: %v", sessionID, err)
+	}
+	return nil
+}
+
+// Owner returns the owner of a registered session
+func (r *SessionRegistry) Owner(sessionID string) (SessionOwner, bool, error) {
+	owner := SessionOwner{SessionID: sessionID}
+	var participant string
+	var createdAt int64
+	err := r.db.QueryRow(`SELECT room_id, participant, created_at FROM session_owners WHERE session_id = ?`,
+		sessionID).Scan(&owner.RoomID, &participant, &createdAt)
+	if err == sql.ErrNoRows {
+		return owner, false, nil
+	}
+	if err != nil {
+		return owner, false, fmt.Errorf("error reading owner of session %s: %v", sessionID, err)
+	}
+	owner.Participant = common.HexToAddress(participant)
+	owner.CreatedAt = time.Unix(createdAt, 0).UTC()
+	return owner, true, nil
+}
+
+// Sessions lists the sessions registered for a participant in a room, oldest first
+func (r *SessionRegistry) Sessions(roomID string, participant common.Address) ([]string, error) {
+	rows, err := r.db.Query(`SELECT session_id FROM session_owners WHERE room_id = ? AND participant = ? ORDER BY created_at, session_id`,
+		roomID, participant.Hex())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []string
+	for rows.Next() {
+		var sessionID string
+		if err := rows.Scan(&sessionID); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, sessionID)
+	}
+	return sessions, rows.Err()
+}
+
+// RoomSessions lists the sessions registered in a room no later than until
+func (r *SessionRegistry) RoomSessions(roomID string, until time.Time) ([]string, error) {
+	rows, err := r.db.Query(`SELECT session_id FROM session_owners WHERE room_id = ? AND created_at <= ? ORDER BY created_at, session_id`,
+		roomID, until.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []string
+	for rows.Next() {
+		var sessionID string
+		if err := rows.Scan(&sessionID); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, sessionID)
+	}
+	return sessions, rows.Err()
+}
+
+// All lists every registered session with its owner, oldest first
+func (r *SessionRegistry) All() ([]SessionOwner, error) {
+	rows, err := r.db.Query(`SELECT session_id, room_id, participant, created_at FROM session_owners ORDER BY created_at, session_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var owners []SessionOwner
+	for rows.Next() {
+		var owner SessionOwner
+		var participant string
+		var createdAt int64
+		if err := rows.Scan(&owner.SessionID, &owner.RoomID, &participant, &createdAt); err != nil {
+			return nil, err
+		}
+		owner.Participant = common.HexToAddress(participant)
+		owner.CreatedAt = time.Unix(createdAt, 0).UTC()
+		owners = append(owners, owner)
+	}
+	return owners, rows.Err()
+}
+
+// VerifyOwner checks that sender owns sessionID in the room and is still a participant of it.
+// Sessions created before the registry existed are adopted when the contract lists them for the sender.
+// Failures are MessageErrors, unauthorized unless the contract or database could not be read.
+func (r *SessionRegistry) VerifyOwner(roomID string, sender common.Address, sessionID string) error {
+	owner, err := r.resolve(roomID, sessionID)
+	if err != nil {
+		return err
+	}
+	if owner.RoomID != roomID || owner.Participant != sender {
+		return NewMessageError(ErrCodeUnauthorized, "session %s does not belong to %s in room %s", sessionID, sender.Hex(), roomID)
+	}
+	return r.verifyParticipant(roomID, sender)
+}
+
+// VerifyRoom checks that sessionID belongs to a participant of the room
+func (r *SessionRegistry) VerifyRoom(roomID string, sessionID string) error {
+	owner, err := r.resolve(roomID, sessionID)
+	if err != nil {
+		return err
+	}
+	if owner.RoomID != roomID {
+		return NewMessageError(ErrCodeUnauthorized, "session %s is not part of room %s", sessionID, roomID)
+	}
+	return nil
+}
+
+// resolve finds the owner of a session in the registry, falling back to the session IDs the contract stores for the room
+func (r *SessionRegistry) resolve(roomID string, sessionID string) (SessionOwner, error) {
+	if sessionID == "" {
+		return SessionOwner{}, NewMessageError(ErrCodeInvalidRequest, "missing session ID")
+	}
+
+	owner, ok, err := r.Owner(sessionID)
+	if err != nil {
+		return owner, NewMessageError(ErrCodeInternal, "%v", err)
+	}
+	if ok {
+		return owner, nil
+	}
+
+	opts := &bind.CallOpts{Context: context.Background()}
+	details, err := r.contractInstance.GetRoomParticipantsDetails(opts, roomID)
+	if err != nil {
+		return owner, NewMessageError(ErrCodeContract, "error reading participants of room %s: %v", roomID, err)
+	}
+	for _, participant := range details {
+		if participant.SessionID == sessionID {
+			if err := r.Record(sessionID, roomID, participant.WalletAddress); err != nil {
+				return owner, NewMessageError(ErrCodeInternal, "%v", err)
+			}
+			return SessionOwner{SessionID: sessionID, RoomID: roomID, Participant: participant.WalletAddress}, nil
+		}
+	}
+	return owner, NewMessageError(ErrCodeUnauthorized, "unknown session %s", sessionID)
+}
+
+// verifyParticipant checks with the contract that the room exists and sender is in it
+func (r *SessionRegistry) verifyParticipant(roomID string, sender common.Address) error {
+	opts := &bind.CallOpts{Context: context.Background()}
+	room, err := r.contractInstance.Rooms(opts, roomID)
+	if err != nil {
+		return NewMessageError(ErrCodeContract, "error reading room %s: %v", roomID, err)
+	}
+	if room.RoomId == "" {
+		return NewMessageError(ErrCodeUnauthorized, "room %s does not exist", roomID)
+	}
+
+	inRoom, err := r.contractInstance.ParticipantsInRoom(opts, roomID, sender)
+	if err != nil {
+		return NewMessageError(ErrCodeContract, "error reading participants of room %s: %v", roomID, err)
+	}
+	if !inRoom {
+		return NewMessageError(ErrCodeUnauthorized, "%s is not a participant of room %s", sender.Hex(), roomID)
+	}
+	return nil
+}
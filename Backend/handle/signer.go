@@ -0,0 +1,195 @@
+package handle
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/external"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"golang.org/x/term"
+)
+
+// Signer backend names accepted in SignerConfig.Backend
+const (
+	SignerBackendRaw      = "raw"
+	SignerBackendKeystore = "keystore"
+	SignerBackendExternal = "external"
+)
+
+// Signer signs transactions on behalf of the backend wallet
+type Signer interface {
+	// Address returns the wallet address transactions are sent from
+	Address() common.Address
+	// SignTx signs the transaction for the given chain
+	SignTx(tx *types.Transaction, chainID *big.Int) (*types.Transaction, error)
+}
+
+// SignerConfig selects and configures a signer backend
+type SignerConfig struct {
+	Backend         string // raw, keystore or external
+	PrivateKey      string // hex private key for the raw backend (dev only)
+	KeystorePath    string // encrypted JSON keystore file
+	PassphraseFile  string // file holding the keystore passphrase; prompts when empty
+	ExternalURL     string // JSON-RPC endpoint of a clef-style external signer
+	ExternalAccount string // account to use on the external signer; first listed when empty
+}
+
+// NewSigner creates the signer backend described by the config
+func NewSigner(cfg SignerConfig) (Signer, error) {
+	switch cfg.Backend {
+	case "", SignerBackendRaw:
+		log.Println("Warning: using raw private key signer, this backend is intended for development only")
+		return NewRawKeySigner(cfg.PrivateKey)
+	case SignerBackendKeystore:
+		passphrase, err := readPassphrase(cfg.PassphraseFile)
+		if err != nil {
+			return nil, err
+		}
+		return NewKeystoreSigner(cfg.KeystorePath, passphrase)
+	case SignerBackendExternal:
+		return NewExternalSigner(cfg.ExternalURL, cfg.ExternalAccount)
+	default:
+		return nil, fmt.Errorf("unknown signer backend: %s", cfg.Backend)
+	}
+}
+
+// keySigner signs transactions with an in-memory private key
+type keySigner struct {
+	privateKey *ecdsa.PrivateKey
+	address    common.Address
+}
+
+// NewRawKeySigner creates a signer from a hex encoded private key
+func NewRawKeySigner(privateKeyHex string) (Signer, error) {
+	if privateKeyHex == "" {
+		return nil, fmt.Errorf("WALLET_PRIVATE_KEY not found in environment")
+	}
+
+	privateKey, err := crypto.HexToECDSA(strings.TrimPrefix(privateKeyHex, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key: %v", err)
+	}
+
+	return &keySigner{
+		privateKey: privateKey,
+		address:    crypto.PubkeyToAddress(privateKey.PublicKey),
+	}, nil
+}
+
+// NewKeystoreSigner creates a signer from a go-ethereum encrypted JSON keystore file
+func NewKeystoreSigner(path string, passphrase string) (Signer, error) {
+	if path == "" {
+		return nil, fmt.Errorf("keystore path not set")
+	}
+
+	keyJSON, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keystore: %v", err)
+	}
+
+	key, err := keystore.DecryptKey(keyJSON, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt keystore: %v", err)
+	}
+
+	return &keySigner{
+		privateKey: key.PrivateKey,
+		address:    key.Address,
+	}, nil
+}
+
+// Address returns the address derived from the private key
+func (s *keySigner) Address() common.Address {
+	return s.address
+}
+
+// SignTx signs the transaction with the private key
+func (s *keySigner) SignTx(tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	return types.SignTx(tx, types.LatestSignerForChainID(chainID), s.privateKey)
+}
+
+// externalSigner delegates signing to a clef-style signer over JSON-RPC
+type externalSigner struct {
+	client  *external.ExternalSigner
+	account accounts.Account
+}
+
+// NewExternalSigner connects to an external signer and selects the signing account
+func NewExternalSigner(endpoint string, account string) (Signer, error) {
+	if endpoint == "" {
+		return nil, fmt.Errorf("external signer URL not set")
+	}
+
+	client, err := external.NewExternalSigner(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to external signer: %v", err)
+	}
+
+	available := client.Accounts()
+	if len(available) == 0 {
+		return nil, fmt.Errorf("external signer has no accounts")
+	}
+
+	selected := available[0]
+	if account != "" {
+		if !common.IsHexAddress(account) {
+			return nil, fmt.Errorf("invalid external signer account: %s", account)
+		}
+		selected = accounts.Account{Address: common.HexToAddress(account)}
+		if !client.Contains(selected) {
+			return nil, fmt.Errorf("external signer does not manage account %s", account)
+		}
+	}
+
+	return &externalSigner{
+		client:  client,
+		account: selected,
+	}, nil
+}
+
+// Address returns the account used on the external signer
+func (s *externalSigner) Address() common.Address {
+	return s.account.Address
+}
+
+// SignTx asks the external signer to sign the transaction
+func (s *externalSigner) SignTx(tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	return s.client.SignTx(s.account, tx, chainID)
+}
+
+// readPassphrase reads a keystore passphrase from a file, or prompts for it on the terminal
+func readPassphrase(passphraseFile string) (string, error) {
+	if passphraseFile != "" {
+		content, err := os.ReadFile(passphraseFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read passphrase file: %v", err)
+		}
+		return strings.TrimRight(string(content), "\r\n"), nil
+	}
+
+	fmt.Fprint(os.Stderr, "Keystore passphrase: ")
+	defer fmt.Fprintln(os.Stderr)
+
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		passphrase, err := term.ReadPassword(int(os.Stdin.Fd()))
+		if err != nil {
+			return "", fmt.Errorf("failed to read passphrase: %v", err)
+		}
+		return string(passphrase), nil
+	}
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("failed to read passphrase: %v", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
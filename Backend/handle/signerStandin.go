@@ -0,0 +1,70 @@
+package handle
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+// localSignerAPI serves the subset of the clef account API used by the external signer backend
+type localSignerAPI struct {
+	signer Signer
+}
+
+// signTransactionResult mirrors clef's account_signTransaction result
+type signTransactionResult struct {
+	Raw hexutil.Bytes      `json:"raw"`
+	Tx  *types.Transaction `json:"tx"`
+}
+
+// NewLocalSignerServer wraps a signer in a JSON-RPC server that stands in for clef,
+// so the external signer backend can be run and exercised without a real clef instance
+func NewLocalSignerServer(signer Signer) (*rpc.Server, error) {
+	server := rpc.NewServer()
+	if err := server.RegisterName("account", &localSignerAPI{signer: signer}); err != nil {
+		return nil, fmt.Errorf("failed to register signer API: %v", err)
+	}
+	return server, nil
+}
+
+// Version implements account_version
+func (api *localSignerAPI) Version() string {
+	return "6.0.0"
+}
+
+// List implements account_list
+func (api *localSignerAPI) List() []common.Address {
+	return []common.Address{api.signer.Address()}
+}
+
+// SignTransaction implements account_signTransaction
+func (api *localSignerAPI) SignTransaction(args apitypes.SendTxArgs) (*signTransactionResult, error) {
+	if args.From.Address() != api.signer.Address() {
+		return nil, fmt.Errorf("unknown account %s", args.From.Address().Hex())
+	}
+
+	tx, err := args.ToTransaction()
+	if err != nil {
+		return nil, fmt.Errorf("invalid transaction: %v", err)
+	}
+
+	if args.ChainID == nil {
+		return nil, fmt.Errorf("chainId is required")
+	}
+
+	signed, err := api.signer.SignTx(tx, args.ChainID.ToInt())
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := signed.MarshalBinary()
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode transaction: %v", err)
+	}
+
+	return &signTransactionResult{Raw: raw, Tx: signed}, nil
+}
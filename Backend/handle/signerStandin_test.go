@@ -0,0 +1,108 @@
+package handle
+
+import (
+	"math/big"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// startSignerStandin serves a stand-in for a fresh raw key on a temporary port and returns its URL
+func startSignerStandin(t *testing.T) (string, common.Address) {
+	t.Helper()
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	signer, err := NewSigner(SignerConfig{
+		Backend:    SignerBackendRaw,
+		PrivateKey: common.Bytes2Hex(crypto.FromECDSA(key)),
+	})
+	if err != nil {
+		t.Fatalf("NewSigner raw: %v", err)
+	}
+
+	server, err := NewLocalSignerServer(signer)
+	if err != nil {
+		t.Fatalf("NewLocalSignerServer: %v", err)
+	}
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(func() {
+		httpServer.Close()
+		server.Stop()
+	})
+	return httpServer.URL, signer.Address()
+}
+
+func TestExternalSignerAgainstStandin(t *testing.T) {
+	url, address := startSignerStandin(t)
+
+	signer, err := NewSigner(SignerConfig{Backend: SignerBackendExternal, ExternalURL: url})
+	if err != nil {
+		t.Fatalf("NewSigner external: %v", err)
+	}
+	if signer.Address() != address {
+		t.Fatalf("external signer uses %s, want %s", signer.Address().Hex(), address.Hex())
+	}
+
+	chainID := big.NewInt(97)
+	to := common.HexToAddress("0x00000000000000000000000000000000000000b2")
+	unsigned := map[string]*types.Transaction{
+		"legacy": types.NewTx(&types.LegacyTx{
+			Nonce:    1,
+			GasPrice: big.NewInt(1_000_000_000),
+			Gas:      3_000_000,
+			To:       &to,
+			Value:    big.NewInt(0),
+			Data:     []byte{0x01, 0x02},
+		}),
+		"dynamic fee": types.NewTx(&types.DynamicFeeTx{
+			ChainID:   chainID,
+			Nonce:     2,
+			GasTipCap: big.NewInt(1_000_000_000),
+			GasFeeCap: big.NewInt(2_000_000_000),
+			Gas:       3_000_000,
+			To:        &to,
+			Value:     big.NewInt(0),
+			Data:      []byte{0x03},
+		}),
+	}
+
+	for name, tx := range unsigned {
+		signed, err := signer.SignTx(tx, chainID)
+		if err != nil {
+			t.Fatalf("%s: SignTx: %v", name, err)
+		}
+		sender, err := types.Sender(types.LatestSignerForChainID(chainID), signed)
+		if err != nil {
+			t.Fatalf("%s: recovering sender: %v", name, err)
+		}
+		if sender != address {
+			t.Errorf("%s: recovered sender %s, want %s", name, sender.Hex(), address.Hex())
+		}
+		if signed.Nonce() != tx.Nonce() || signed.Gas() != tx.Gas() || *signed.To() != to {
+			t.Errorf("%s: signed transaction differs from the one requested", name)
+		}
+	}
+}
+
+func TestExternalSignerAccountSelection(t *testing.T) {
+	url, address := startSignerStandin(t)
+
+	signer, err := NewSigner(SignerConfig{Backend: SignerBackendExternal, ExternalURL: url, ExternalAccount: address.Hex()})
+	if err != nil {
+		t.Fatalf("NewSigner with the served account: %v", err)
+	}
+	if signer.Address() != address {
+		t.Errorf("external signer uses %s, want %s", signer.Address().Hex(), address.Hex())
+	}
+
+	other := common.HexToAddress("0x00000000000000000000000000000000000000c3")
+	if _, err := NewSigner(SignerConfig{Backend: SignerBackendExternal, ExternalURL: url, ExternalAccount: other.Hex()}); err == nil {
+		t.Error("NewSigner accepted an account the stand-in does not manage")
+	}
+}
@@ -0,0 +1,209 @@
+package handle
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// UnixSocketSink serves the record stream as JSON Lines to every client connected to a Unix socket.
+// Clients that cannot keep up are disconnected.
+type UnixSocketSink struct {
+	mu       sync.Mutex
+	path     string
+	listener net.Listener
+	clients  map[net.Conn]struct{}
+}
+
+// NewUnixSocketSink listens on the socket path, replacing a stale socket file
+func NewUnixSocketSink(path string) (*UnixSocketSink, error) {
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on event socket: %v", err)
+	}
+
+	s := &UnixSocketSink{
+		path:     path,
+		listener: listener,
+		clients:  make(map[net.Conn]struct{}),
+	}
+	go s.accept()
+	return s, nil
+}
+
+// accept registers connecting clients until the listener is closed
+func (s *UnixSocketSink) accept() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.clients[conn] = struct{}{}
+		s.mu.Unlock()
+	}
+}
+
+// Publish writes one JSON line to every connected client
+func (s *UnixSocketSink) Publish(record SinkRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("error marshaling sink record: %v", err)
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for conn := range s.clients {
+		conn.SetWriteDeadline(time.Now().Add(time.Second))
+		if _, err := conn.Write(line); err != nil {
+			log.Printf("[Sink] Dropping event socket client: %v", err)
+			conn.Close()
+			delete(s.clients, conn)
+		}
+	}
+	return nil
+}
+
+// Close stops listening and disconnects every client
+func (s *UnixSocketSink) Close() error {
+	err := s.listener.Close()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.clients {
+		conn.Close()
+		delete(s.clients, conn)
+	}
+	return err
+}
+
+// MessageBroker is the minimal publish interface of a message broker client
+type MessageBroker interface {
+	Publish(topic string, payload []byte) error
+	Close() error
+}
+
+// messageBrokers are the brokers event sinks can publish to, by name
+var (
+	messageBrokersMu sync.Mutex
+	messageBrokers   = map[string]MessageBroker{"local": DefaultLocalBroker}
+)
+
+// DefaultLocalBroker is the in-process broker registered as "local", for consumers built into the backend
+var DefaultLocalBroker = NewLocalBroker()
+
+// RegisterMessageBroker makes a broker client available to "broker:<name>" event sinks
+func RegisterMessageBroker(name string, broker MessageBroker) {
+	messageBrokersMu.Lock()
+	defer messageBrokersMu.Unlock()
+	messageBrokers[name] = broker
+}
+
+// lookupMessageBroker returns the broker registered under name
+func lookupMessageBroker(name string) (MessageBroker, bool) {
+	messageBrokersMu.Lock()
+	defer messageBrokersMu.Unlock()
+	broker, ok := messageBrokers[name]
+	return broker, ok
+}
+
+// BrokerSink publishes records to a message broker, one topic per record kind and event name
+// such as "meeting.contract-event.ParticipantJoined"
+type BrokerSink struct {
+	broker      MessageBroker
+	topicPrefix string
+}
+
+// NewBrokerSink creates a sink on top of a broker client
+func NewBrokerSink(broker MessageBroker, topicPrefix string) *BrokerSink {
+	if topicPrefix == "" {
+		topicPrefix = "meeting"
+	}
+	return &BrokerSink{broker: broker, topicPrefix: topicPrefix}
+}
+
+// Publish sends the record as JSON to its topic
+func (s *BrokerSink) Publish(record SinkRecord) error {
+	payload, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("error marshaling sink record: %v", err)
+	}
+	return s.broker.Publish(fmt.Sprintf("%s.%s.%s", s.topicPrefix, record.Kind, record.EventName), payload)
+}
+
+// Close closes the broker client
+func (s *BrokerSink) Close() error {
+	return s.broker.Close()
+}
+
+// LocalBroker is an in-process MessageBroker delivering to channel subscribers
+type LocalBroker struct {
+	mu          sync.Mutex
+	subscribers map[string][]chan []byte
+	closed      bool
+}
+
+// NewLocalBroker creates an in-process broker
+func NewLocalBroker() *LocalBroker {
+	return &LocalBroker{subscribers: make(map[string][]chan []byte)}
+}
+
+// Subscribe returns a channel receiving the payloads published to a topic.
+// Payloads are dropped when the channel buffer is full.
+func (b *LocalBroker) Subscribe(topic string, buffer int) <-chan []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan []byte, buffer)
+	if b.closed {
+		close(ch)
+		return ch
+	}
+	b.subscribers[topic] = append(b.subscribers[topic], ch)
+	return ch
+}
+
+// Publish delivers the payload to the topic subscribers without blocking
+func (b *LocalBroker) Publish(topic string, payload []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return fmt.Errorf("broker is closed")
+	}
+	for _, ch := range b.subscribers[topic] {
+		select {
+		case ch <- payload:
+		default:
+		}
+	}
+	return nil
+}
+
+// Close closes every subscriber channel
+func (b *LocalBroker) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	for topic, channels := range b.subscribers {
+		for _, ch := range channels {
+			close(ch)
+		}
+		delete(b.subscribers, topic)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package handle
+
+import (
+	"sync"
+	"time"
+
+	contract "dappmeetingnew/constract"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// trackAnnouncementWindow is how long an announced track is remembered, so a retried
+// publish does not announce the same track twice
+const trackAnnouncementWindow = 10 * time.Minute
+
+// trackAnnouncements remembers recently announced tracks
+type trackAnnouncements struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+// first reports whether the track was not announced within the window, and remembers it
+func (a *trackAnnouncements) first(roomID string, sessionID string, trackName string) bool {
+	key := roomID + "/" + sessionID + "/" + trackName
+	now := time.Now()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.seen == nil {
+		a.seen = make(map[string]time.Time)
+	}
+	for seenKey, seenAt := range a.seen {
+		if now.Sub(seenAt) > trackAnnouncementWindow {
+			delete(a.seen, seenKey)
+		}
+	}
+	if _, ok := a.seen[key]; ok {
+		return false
+	}
+	a.seen[key] = now
+	return true
+}
+
+// announceTracks sends every other participant one track-available message for the tracks or data
+// channels a request published, with their simulcast layers when known. Tracks announced within the
+// window are left out. The publisher is charged a rate limit token per recipient; announcements
+// that do not fit its budget are skipped, the tracks stay discoverable on the contract.
+func (h *EventHandler) announceTracks(ctx *MessageContext, publisher common.Address, sessionID string, tracks []AvailableTrack) {
+	var fresh []AvailableTrack
+	for _, track := range tracks {
+		if sessionID != "" && track.TrackName != "" && h.announced.first(ctx.RoomID, sessionID, track.TrackName) {
+			fresh = append(fresh, track)
+		}
+	}
+	if len(fresh) == 0 {
+		return
+	}
+
+	participants, err := h.roomParticipants(ctx.RoomID)
+	if err != nil {
+		ctx.Logf("Error reading participants to announce %d tracks: %v", len(fresh), err)
+		return
+	}
+	recipients := len(broadcastRecipients(participants, []common.Address{publisher}))
+	if recipients == 0 {
+		return
+	}
+	if h.rateLimiter != nil && !ctx.retry && !h.rateLimiter.Charge(ctx.RoomID, publisher, recipients) {
+		ctx.Logf("Rate limit exceeded, not announcing %d tracks of %s to %d participants", len(fresh), publisher.Hex(), recipients)
+		return
+	}
+
+	notification := TrackAvailableNotification{
+		MessageHeader: responseHeader("track-available", logRequestID(ctx.Raw)),
+		Publisher:     publisher.Hex(),
+		SessionID:     sessionID,
+		Tracks:        fresh,
+	}
+	for _, participant := range participants {
+		if participant.WalletAddress == publisher {
+			notification.PublisherName = participant.Name
+		}
+	}
+
+	ctx.Logf("Announcing %d tracks of %s to room %s", len(fresh), publisher.Hex(), ctx.RoomID)
+	h.notifyParticipants(ctx, participants, publisher, notification)
+}
+
+// publishedInitialTracks returns the initial tracks of a join that Cloudflare published in the new session
+func publishedInitialTracks(cloudflareResponse map[string]interface{}, initialTracks []contract.DAppMeetingTrack) []AvailableTrack {
+	locations := make(map[string]string, len(initialTracks))
+	for _, track := range initialTracks {
+		locations[track.TrackName] = track.Location
+	}
+
+	var published []AvailableTrack
+	cloudflareTracks, _ := cloudflareResponse["tracks"].([]interface{})
+	for _, cfTrack := range cloudflareTracks {
+		track, ok := cfTrack.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		trackName, _ := track["trackName"].(string)
+		mid, _ := track["mid"].(string)
+		location, initial := locations[trackName]
+		if trackName == "" || mid == "" || !initial {
+			continue
+		}
+		if location == "" {
+			location = "local"
+		}
+		published = append(published, AvailableTrack{TrackName: trackName, Mid: mid, Location: location})
+	}
+	return published
+}
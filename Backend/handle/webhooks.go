@@ -0,0 +1,445 @@
+package handle
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Meeting lifecycle event types delivered to webhooks
+const (
+	WebhookParticipantJoined = "participant.joined"
+	WebhookParticipantLeft   = "participant.left"
+	WebhookTrackPublished    = "track.published"
+	WebhookMeetingEnded      = "meeting.ended"
+)
+
+// Webhook delivery states
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// webhookSchema creates the delivery log table
+var webhookSchema = []string{
+	`CREATE TABLE IF NOT EXISTS webhook_deliveries (
+		id               INTEGER PRIMARY KEY AUTOINCREMENT,
+		subscription_id  TEXT    NOT NULL,
+		event_id         TEXT    NOT NULL,
+		event_type       TEXT    NOT NULL,
+		room_id          TEXT    NOT NULL,
+		url              TEXT    NOT NULL,
+		payload          TEXT    NOT NULL,
+		status           TEXT    NOT NULL,
+		attempts         INTEGER NOT NULL DEFAULT 0,
+		last_status_code INTEGER NOT NULL DEFAULT 0,
+		last_error       TEXT    NOT NULL DEFAULT '',
+		next_attempt_at  INTEGER NOT NULL,
+		created_at       INTEGER NOT NULL,
+		updated_at       INTEGER NOT NULL,
+		UNIQUE (subscription_id, event_id)
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries (status, next_attempt_at)`,
+}
+
+// WebhookSubscription is a configured webhook endpoint
+type WebhookSubscription struct {
+	ID     string   `json:"id"`
+	URL    string   `json:"url"`
+	Secret string   `json:"secret"`
+	Events []string `json:"events"` // event types to deliver, all when empty
+	Rooms  []string `json:"rooms"`  // room IDs to deliver, all when empty
+}
+
+// WebhookEvent is the JSON payload delivered to webhook subscribers
+type WebhookEvent struct {
+	ID          string                 `json:"id"`
+	Type        string                 `json:"type"`
+	RoomID      string                 `json:"roomId"`
+	Participant string                 `json:"participant"`
+	OccurredAt  time.Time              `json:"occurredAt"`
+	BlockNumber uint64                 `json:"blockNumber"`
+	TxHash      string                 `json:"txHash"`
+	Data        map[string]interface{} `json:"data,omitempty"`
+}
+
+// WebhookDelivery is one entry of the delivery log
+type WebhookDelivery struct {
+	ID             int64     `json:"id"`
+	SubscriptionID string    `json:"subscriptionId"`
+	EventID        string    `json:"eventId"`
+	EventType      string    `json:"eventType"`
+	RoomID         string    `json:"roomId"`
+	URL            string    `json:"url"`
+	Payload        string    `json:"payload"`
+	Status         string    `json:"status"`
+	Attempts       int       `json:"attempts"`
+	LastStatusCode int       `json:"lastStatusCode"`
+	LastError      string    `json:"lastError"`
+	NextAttemptAt  time.Time `json:"nextAttemptAt"`
+	CreatedAt      time.Time `json:"createdAt"`
+	UpdatedAt      time.Time `json:"updatedAt"`
+}
+
+// WebhookDispatcher delivers signed lifecycle events to subscribers with retries,
+// keeping every delivery in a persisted log
+type WebhookDispatcher struct {
+	db            *sql.DB
+	subscriptions []WebhookSubscription
+	client        *http.Client
+	maxAttempts   int
+	baseBackoff   time.Duration
+	blockTime     func(blockNumber uint64) (time.Time, error)
+	wake          chan struct{}
+}
+
+// maxWebhookBackoff caps the delay between two delivery attempts
+const maxWebhookBackoff = time.Hour
+
+// LoadWebhookSubscriptions reads webhook subscriptions from a JSON file
+func LoadWebhookSubscriptions(path string) ([]WebhookSubscription, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read webhook config: %v", err)
+	}
+
+	var subscriptions []WebhookSubscription
+	if err := json.Unmarshal(content, &subscriptions); err != nil {
+		return nil, fmt.Errorf("failed to parse webhook config: %v", err)
+	}
+
+	for i, subscription := range subscriptions {
+		if subscription.ID == "" || subscription.URL == "" {
+			return nil, fmt.Errorf("webhook subscription %d needs an id and a url", i)
+		}
+		if subscription.Secret == "" {
+			log.Printf("Warning: webhook subscription %s has no secret, payloads will be unsigned", subscription.ID)
+		}
+	}
+	return subscriptions, nil
+}
+
+// NewWebhookDispatcher creates a dispatcher for the given subscriptions
+func NewWebhookDispatcher(db *sql.DB, subscriptions []WebhookSubscription, maxAttempts int) (*WebhookDispatcher, error) {
+	if err := migrate(db, webhookSchema); err != nil {
+		return nil, err
+	}
+	if maxAttempts <= 0 {
+		maxAttempts = 6
+	}
+	return &WebhookDispatcher{
+		db:            db,
+		subscriptions: subscriptions,
+		client:        &http.Client{Timeout: 10 * time.Second},
+		maxAttempts:   maxAttempts,
+		baseBackoff:   2 * time.Second,
+		wake:          make(chan struct{}, 1),
+	}, nil
+}
+
+// NewWebhookEvent builds a lifecycle event from the contract log that caused it.
+// Publish sets OccurredAt to the time of the log's block.
+func NewWebhookEvent(eventType string, roomID string, participant common.Address, raw types.Log, data map[string]interface{}) WebhookEvent {
+	return WebhookEvent{
+		ID:          fmt.Sprintf("%s-%d", raw.TxHash.Hex(), raw.Index),
+		Type:        eventType,
+		RoomID:      roomID,
+		Participant: participant.Hex(),
+		BlockNumber: raw.BlockNumber,
+		TxHash:      raw.TxHash.Hex(),
+		Data:        data,
+	}
+}
+
+// NewMeetingEndedWebhookEvent builds the meeting.ended event of an ended meeting
+func NewMeetingEndedWebhookEvent(meeting MeetingRecord) WebhookEvent {
+	return WebhookEvent{
+		ID:         fmt.Sprintf("meeting-%d", meeting.ID),
+		Type:       WebhookMeetingEnded,
+		RoomID:     meeting.RoomID,
+		OccurredAt: meeting.EndedAt,
+		Data: map[string]interface{}{
+			"startedAt":        meeting.StartedAt,
+			"durationSeconds":  meeting.DurationSeconds,
+			"peakParticipants": meeting.PeakParticipants,
+			"sessionsClosed":   meeting.SessionsClosed,
+		},
+	}
+}
+
+// matches reports whether the subscription wants the event
+func (s WebhookSubscription) matches(event WebhookEvent) bool {
+	return matchesFilter(s.Events, event.Type) && matchesFilter(s.Rooms, event.RoomID)
+}
+
+// matchesFilter reports whether value is in the filter; an empty filter matches everything
+func matchesFilter(filter []string, value string) bool {
+	if len(filter) == 0 {
+		return true
+	}
+	for _, item := range filter {
+		if item == value || item == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// Publish queues the event for every matching subscription
+func (d *WebhookDispatcher) Publish(event WebhookEvent) error {
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = d.occurredAt(event.BlockNumber)
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("error marshaling webhook event: %v", err)
+	}
+
+	now := time.Now().Unix()
+	queued := 0
+	for _, subscription := range d.subscriptions {
+		if !subscription.matches(event) {
+			continue
+		}
+		_, err := d.db.Exec(`INSERT OR IGNORE INTO webhook_deliveries
+			(subscription_id, event_id, event_type, room_id, url, payload, status, next_attempt_at, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			subscription.ID, event.ID, event.Type, event.RoomID, subscription.URL, string(payload),
+			DeliveryPending, now, now, now)
+		if err != nil {
+			return fmt.Errorf("error queuing webhook delivery: %v", err)
+		}
+		queued++
+	}
+
+	if queued > 0 {
+		d.signal()
+	}
+	return nil
+}
+
+// SetBlockTimes sets how block timestamps are read, for the time contract events occurred at
+func (d *WebhookDispatcher) SetBlockTimes(blockTime func(blockNumber uint64) (time.Time, error)) {
+	d.blockTime = blockTime
+}
+
+// occurredAt returns the time of a block, or the current time when it cannot be read
+func (d *WebhookDispatcher) occurredAt(blockNumber uint64) time.Time {
+	if d.blockTime != nil && blockNumber > 0 {
+		t, err := d.blockTime(blockNumber)
+		if err == nil {
+			return t
+		}
+		log.Printf("[Webhook] Error reading time of block %d: %v", blockNumber, err)
+	}
+	return time.Now().UTC()
+}
+
+// backoff returns the delay before the next attempt after the given number of failed ones
+func (d *WebhookDispatcher) backoff(attempts int) time.Duration {
+	delay := d.baseBackoff
+	for i := 1; i < attempts && delay < maxWebhookBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxWebhookBackoff {
+		delay = maxWebhookBackoff
+	}
+	return delay
+}
+
+// signal wakes the delivery loop
+func (d *WebhookDispatcher) signal() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run delivers due webhooks until the context is canceled, including deliveries left pending by a restart
+func (d *WebhookDispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		d.deliverDue()
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// deliverDue attempts every pending delivery whose retry time has come
+func (d *WebhookDispatcher) deliverDue() {
+	deliveries, err := d.queryDeliveries(`WHERE status = ? AND next_attempt_at <= ? ORDER BY id LIMIT 50`,
+		DeliveryPending, time.Now().Unix())
+	if err != nil {
+		log.Printf("[Webhook] Error reading pending deliveries: %v", err)
+		return
+	}
+	for _, delivery := range deliveries {
+		d.attempt(delivery)
+	}
+}
+
+// attempt sends a delivery once and records the outcome, scheduling a retry with backoff on failure
+func (d *WebhookDispatcher) attempt(delivery WebhookDelivery) error {
+	statusCode, err := d.send(delivery)
+	delivery.Attempts++
+	now := time.Now()
+
+	status := DeliveryDelivered
+	lastError := ""
+	nextAttempt := now
+	if err != nil {
+		lastError = err.Error()
+		status = DeliveryPending
+		if delivery.Attempts >= d.maxAttempts {
+			status = DeliveryFailed
+		}
+		nextAttempt = now.Add(d.backoff(delivery.Attempts))
+		log.Printf("[Webhook] Delivery %d to %s failed (attempt %d/%d): %v",
+			delivery.ID, delivery.URL, delivery.Attempts, d.maxAttempts, err)
+	} else {
+		log.Printf("[Webhook] Delivered %s event %s to %s", delivery.EventType, delivery.EventID, delivery.URL)
+	}
+
+	_, dbErr := d.db.Exec(`UPDATE webhook_deliveries SET status = ?, attempts = ?, last_status_code = ?,
+		last_error = ?, next_attempt_at = ?, updated_at = ? WHERE id = ?`,
+		status, delivery.Attempts, statusCode, lastError, nextAttempt.Unix(), now.Unix(), delivery.ID)
+	if dbErr != nil {
+		log.Printf("[Webhook] Error updating delivery %d: %v", delivery.ID, dbErr)
+	}
+	return err
+}
+
+// send posts the signed payload to the subscriber
+func (d *WebhookDispatcher) send(delivery WebhookDelivery) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, delivery.URL, bytes.NewBufferString(delivery.Payload))
+	if err != nil {
+		return 0, fmt.Errorf("error creating request: %v", err)
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Meeting-Event", delivery.EventType)
+	req.Header.Set("X-Meeting-Delivery", strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set("X-Meeting-Timestamp", timestamp)
+	if secret := d.secretFor(delivery.SubscriptionID); secret != "" {
+		req.Header.Set("X-Meeting-Signature", "sha256="+SignWebhookPayload(secret, timestamp, []byte(delivery.Payload)))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("error making request: %v", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// secretFor returns the signing secret of a subscription
+func (d *WebhookDispatcher) secretFor(subscriptionID string) string {
+	for _, subscription := range d.subscriptions {
+		if subscription.ID == subscriptionID {
+			return subscription.Secret
+		}
+	}
+	return ""
+}
+
+// SignWebhookPayload computes the hex HMAC-SHA256 of "<timestamp>.<payload>".
+// Receivers recompute it with the shared secret to verify the X-Meeting-Signature header.
+func SignWebhookPayload(secret string, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Deliveries lists the delivery log, newest first, optionally filtered by status
+func (d *WebhookDispatcher) Deliveries(status string, limit int) ([]WebhookDelivery, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+	if status == "" {
+		return d.queryDeliveries(`ORDER BY id DESC LIMIT ?`, limit)
+	}
+	return d.queryDeliveries(`WHERE status = ? ORDER BY id DESC LIMIT ?`, status, limit)
+}
+
+// Replay sends a logged delivery again right away, whatever its current state
+func (d *WebhookDispatcher) Replay(id int64) error {
+	deliveries, err := d.queryDeliveries(`WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if len(deliveries) == 0 {
+		return fmt.Errorf("delivery %d not found", id)
+	}
+
+	delivery := deliveries[0]
+	delivery.Attempts = 0
+	return d.attempt(delivery)
+}
+
+// ReplayFailed re-queues every failed delivery for another round of attempts
+func (d *WebhookDispatcher) ReplayFailed() (int64, error) {
+	now := time.Now().Unix()
+	result, err := d.db.Exec(`UPDATE webhook_deliveries SET status = ?, attempts = 0, next_attempt_at = ?, updated_at = ?
+		WHERE status = ?`, DeliveryPending, now, now, DeliveryFailed)
+	if err != nil {
+		return 0, err
+	}
+	d.signal()
+	return result.RowsAffected()
+}
+
+// queryDeliveries reads delivery log rows matching the SQL suffix
+func (d *WebhookDispatcher) queryDeliveries(suffix string, args ...interface{}) ([]WebhookDelivery, error) {
+	rows, err := d.db.Query(`SELECT id, subscription_id, event_id, event_type, room_id, url, payload, status,
+		attempts, last_status_code, last_error, next_attempt_at, created_at, updated_at
+		FROM webhook_deliveries `+suffix, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []WebhookDelivery
+	for rows.Next() {
+		var delivery WebhookDelivery
+		var nextAttempt, createdAt, updatedAt int64
+		if err := rows.Scan(&delivery.ID, &delivery.SubscriptionID, &delivery.EventID, &delivery.EventType,
+			&delivery.RoomID, &delivery.URL, &delivery.Payload, &delivery.Status, &delivery.Attempts,
+			&delivery.LastStatusCode, &delivery.LastError, &nextAttempt, &createdAt, &updatedAt); err != nil {
+			return nil, err
+		}
+		delivery.NextAttemptAt = time.Unix(nextAttempt, 0).UTC()
+		delivery.CreatedAt = time.Unix(createdAt, 0).UTC()
+		delivery.UpdatedAt = time.Unix(updatedAt, 0).UTC()
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
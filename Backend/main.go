@@ -6,6 +6,8 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -26,10 +28,30 @@ var (
 	cloudflareAppID     string
 	cloudflareAppSecret string
 	walletPrivateKey    string
+	signerBackend       string
+	keystorePath        string
+	keystorePassFile    string
+	externalSignerURL   string
+	externalSignerAcct  string
+	projectionSeeds     []string
+	apiListenAddr       string
+	apiCORSOrigin       string
+	viewCacheTTL        time.Duration
+	databasePath        string
+	webhookConfigPath   string
+	webhookMaxAttempts  int
+	eventSinkSpecs      []string
+	eventSinkMaxMB      int
+	eventSinkMaxFiles   int
+	rateLimitConfig     handle.RateLimitConfig
+	chatJoinHistory     int
+	roomIdleGrace       time.Duration
+	sessionPollInterval time.Duration
+	sessionStaleAfter   time.Duration
 )
 
 func init() {
-	godotenv.Load() // Load environment variables from .env file
+	loadEnv()
 
 	// Load configurations with fallback to defaults
 	ethereumNodeURL = getEnv("ETHEREUM_NODE_URL", "wss://bsc-testnet-rpc.publicnode.com")
@@ -38,20 +60,66 @@ func init() {
 	cloudflareAppID = getEnv("CLOUDFLARE_APP_ID", "977c39eac9a8fc03a471d7da6a7d66e0")
 	cloudflareAppSecret = getEnv("CLOUDFLARE_APP_SECRET", "f069115dbeb5847040e7dbb7f9c79772fa923534fe1f74e3a62d54561aa12118")
 	walletPrivateKey = getEnv("WALLET_PRIVATE_KEY", "")
+	signerBackend = getEnv("SIGNER_BACKEND", handle.SignerBackendRaw)
+	keystorePath = getEnv("KEYSTORE_PATH", "")
+	keystorePassFile = getEnv("KEYSTORE_PASSWORD_FILE", "")
+	externalSignerURL = getEnv("EXTERNAL_SIGNER_URL", "")
+	externalSignerAcct = getEnv("EXTERNAL_SIGNER_ACCOUNT", "")
+	projectionSeeds = splitList(getEnv("PROJECTION_SEED_ROOMS", ""))
+	apiListenAddr = getEnv("API_LISTEN_ADDR", ":8080")
+	apiCORSOrigin = getEnv("API_CORS_ORIGIN", "*")
+	viewCacheTTL = getEnvDuration("VIEW_CACHE_TTL", 30*time.Second)
+	databasePath = getEnv("DATABASE_PATH", "meeting.db")
+	webhookConfigPath = getEnv("WEBHOOK_CONFIG", "")
+	webhookMaxAttempts = getEnvInt("WEBHOOK_MAX_ATTEMPTS", 6)
+	eventSinkSpecs = splitList(getEnv("EVENT_SINKS", ""))
+	eventSinkMaxMB = getEnvInt("EVENT_SINK_MAX_MB", 100)
+	eventSinkMaxFiles = getEnvInt("EVENT_SINK_MAX_FILES", 5)
+	chatJoinHistory = getEnvInt("CHAT_JOIN_HISTORY", 20)
+	roomIdleGrace = getEnvDuration("ROOM_IDLE_GRACE", 5*time.Minute)
+	sessionPollInterval = getEnvDuration("SESSION_POLL_INTERVAL", time.Minute)
+	sessionStaleAfter = getEnvDuration("SESSION_STALE_AFTER", 3*time.Minute)
+	rateLimitConfig = handle.RateLimitConfig{
+		Sender: getEnvRatePolicy("RATE_LIMIT_SENDER", "10/1m", getEnvInt("RATE_LIMIT_SENDER_BURST", 5)),
+		Room:   getEnvRatePolicy("RATE_LIMIT_ROOM", "60/1m", getEnvInt("RATE_LIMIT_ROOM_BURST", 20)),
+		Global: getEnvRatePolicy("RATE_LIMIT_GLOBAL", "300/1m", getEnvInt("RATE_LIMIT_GLOBAL_BURST", 50)),
+		Abuse: handle.AbusePolicy{
+			Threshold: getEnvInt("RATE_LIMIT_ABUSE_THRESHOLD", 10),
+			Window:    getEnvDuration("RATE_LIMIT_ABUSE_WINDOW", 10*time.Minute),
+			Block:     getEnvDuration("RATE_LIMIT_ABUSE_BLOCK", time.Hour),
+		},
+	}
 
 	log.Printf("Ethereum Node URL: %s\n", ethereumNodeURL)
 	log.Printf("Contract Address: %s\n", contractAddress)
 	log.Printf("Cloudflare Base URL: %s\n", cloudflareBaseURL)
+	log.Printf("Signer Backend: %s\n", signerBackend)
 
 	if cloudflareAppID == "" || cloudflareAppSecret == "" {
 		log.Println("Warning: Cloudflare credentials not set. Please check your environment variables.")
 	}
 
-	if walletPrivateKey == "" {
+	if signerBackend == handle.SignerBackendRaw && walletPrivateKey == "" {
 		log.Println("Warning: Wallet private key not set. Please check your environment variables.")
 	}
 }
 
+// loadEnv loads the first .env file found in the directories the backend is usually started from.
+// Without one, the configuration comes from the process environment alone.
+func loadEnv() {
+	paths := []string{
+		".env",       // Current directory
+		"../.env",    // Parent directory
+		"../../.env", // Two levels up
+		"D:/DAppMeetingNew/backend/.env",
+	}
+	for _, path := range paths {
+		if err := godotenv.Load(path); err == nil {
+			return
+		}
+	}
+}
+
 func getEnv(key, fallback string) string {
 	value := os.Getenv(key)
 	if value == "" {
@@ -60,7 +128,76 @@ func getEnv(key, fallback string) string {
 	return value
 }
 
+// getEnvDuration reads a duration setting such as "30s", falling back on invalid values
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Warning: invalid duration for %s: %v, using %s", key, err, fallback)
+		return fallback
+	}
+	return duration
+}
+
+// getEnvInt reads an integer setting, falling back on invalid values
+func getEnvInt(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Warning: invalid number for %s: %v, using %d", key, err, fallback)
+		return fallback
+	}
+	return number
+}
+
+// getEnvRatePolicy reads a "<requests>/<interval>" rate policy, falling back on invalid values
+func getEnvRatePolicy(key, fallback string, burst int) handle.RatePolicy {
+	policy, err := handle.ParseRatePolicy(getEnv(key, fallback), burst)
+	if err != nil {
+		log.Printf("Warning: %v for %s, using %s", err, key, fallback)
+		policy, _ = handle.ParseRatePolicy(fallback, burst)
+	}
+	return policy
+}
+
+// splitList splits a comma separated setting, dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// signerConfig collects the signer settings loaded from the environment
+func signerConfig() handle.SignerConfig {
+	return handle.SignerConfig{
+		Backend:         signerBackend,
+		PrivateKey:      walletPrivateKey,
+		KeystorePath:    keystorePath,
+		PassphraseFile:  keystorePassFile,
+		ExternalURL:     externalSignerURL,
+		ExternalAccount: externalSignerAcct,
+	}
+}
+
 func main() {
+	// Run a maintenance command instead of the event listener when one is given
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1], os.Args[2:]); err != nil {
+			log.Fatalf("Command %s failed: %v", os.Args[1], err)
+		}
+		return
+	}
+
 	// Connect to Ethereum node
 	client, err := ethclient.Dial(ethereumNodeURL)
 	if err != nil {
@@ -81,22 +218,153 @@ func main() {
 	cloudflareService := handle.NewCloudflareService(cloudflareBaseURL, cloudflareAppID, cloudflareAppSecret)
 	fmt.Println("Cloudflare service initialized")
 
+	// Initialize the signer backend for the backend wallet
+	signer, err := handle.NewSigner(signerConfig())
+	if err != nil {
+		log.Fatalf("Failed to initialize signer: %v", err)
+	}
+	fmt.Println("Signer initialized for wallet:", signer.Address().Hex())
+
 	// Initialize SMCallManager for transaction handling
-	smCallManager, err := handle.NewSMCallManager(client, address)
+	smCallManager, err := handle.NewSMCallManager(client, address, signer)
 	if err != nil {
 		log.Fatalf("Failed to initialize SM Call Manager: %v", err)
 	}
 	defer smCallManager.Close()
 	fmt.Println("SM Call Manager initialized with single wallet and queue system")
 
+	// Initialize the room state projection, seeded from the contract views
+	projection := handle.NewRoomProjection(client, contractInstance)
+	if err := projection.Seed(projectionSeeds); err != nil {
+		log.Printf("Warning: failed to seed room projection: %v", err)
+	}
+	fmt.Println("Room projection initialized")
+
 	// Initialize EventHandler
 	eventHandler := handle.NewEventHandler(contractInstance, cloudflareService, smCallManager)
+	eventHandler.SetProjection(projection)
+	eventHandler.SetRateLimiter(handle.NewRateLimiter(rateLimitConfig))
+	log.Printf("Rate limits - sender: %s, room: %s, global: %s",
+		rateLimitConfig.Sender, rateLimitConfig.Room, rateLimitConfig.Global)
 	fmt.Println("Event Handler initialized")
 
+	// Open the local database and the contract event indexer
+	db, err := handle.OpenDatabase(databasePath)
+	if err != nil {
+		log.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	indexer, err := handle.NewEventIndexer(db, client, contractInstance)
+	if err != nil {
+		log.Fatalf("Failed to initialize event indexer: %v", err)
+	}
+	if head, err := client.BlockNumber(context.Background()); err == nil {
+		if err := indexer.CatchUp(context.Background(), head); err != nil {
+			log.Printf("Warning: event index catch-up failed: %v", err)
+		}
+	}
+	fmt.Println("Event indexer initialized with database:", databasePath)
+
+	// Keep failed events for retry and checkpoint the steps of every request
+	deadLetters, err := handle.NewDeadLetterStore(db)
+	if err != nil {
+		log.Fatalf("Failed to initialize dead letter store: %v", err)
+	}
+	eventHandler.SetDeadLetters(deadLetters)
+
+	// Record the cost of every mined transaction, aggregated with `go run . gas-report`
+	gasLedger, err := handle.NewGasLedger(db)
+	if err != nil {
+		log.Fatalf("Failed to initialize gas ledger: %v", err)
+	}
+	smCallManager.SetGasLedger(gasLedger)
+
+	// Track which participant owns each Cloudflare session
+	sessions, err := handle.NewSessionRegistry(db, contractInstance)
+	if err != nil {
+		log.Fatalf("Failed to initialize session registry: %v", err)
+	}
+	eventHandler.SetSessions(sessions)
+
+	// Close sessions that stay disconnected and tell their owner and room
+	reaper := handle.NewSessionReaper(cloudflareService, sessions, sessionStaleAfter)
+	reaper.OnReaped(func(owner handle.SessionOwner, trackNames []string, reason string) {
+		eventHandler.NotifySessionClosed(owner, trackNames, reason)
+	})
+
+	// Store chat messages relayed through the backend
+	chat, err := handle.NewChatStore(db)
+	if err != nil {
+		log.Fatalf("Failed to initialize chat store: %v", err)
+	}
+	eventHandler.SetChat(chat, chatJoinHistory)
+
+	// Initialize the contract view cache and the read-only HTTP API on top of it
+	viewCache := handle.NewContractViewCache(contractInstance, viewCacheTTL)
+	if apiListenAddr != "" {
+		apiServer := handle.NewAPIServer(apiListenAddr, viewCache, apiCORSOrigin)
+		apiServer.SetIndexer(indexer)
+		apiServer.AddMetrics(reaper)
+		go func() {
+			if err := apiServer.ListenAndServe(); err != nil {
+				log.Printf("API server stopped: %v", err)
+			}
+		}()
+		defer apiServer.Shutdown(context.Background())
+		fmt.Println("HTTP API listening on", apiListenAddr)
+	}
+
 	// Create a context that can be canceled
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// Start webhook delivery when subscriptions are configured
+	var webhooks *handle.WebhookDispatcher
+	if webhookConfigPath != "" {
+		webhooks, err = openWebhooks(db)
+		if err != nil {
+			log.Fatalf("Failed to initialize webhooks: %v", err)
+		}
+		webhooks.SetBlockTimes(indexer.BlockTime)
+		eventHandler.SetWebhooks(webhooks)
+		go webhooks.Run(ctx)
+		fmt.Println("Webhook delivery started from config:", webhookConfigPath)
+	}
+
+	// Open the event sinks receiving every decoded event and handler outcome
+	sinks := handle.NewSinkGroup()
+	for _, spec := range eventSinkSpecs {
+		sink, err := handle.OpenEventSink(spec, int64(eventSinkMaxMB)<<20, eventSinkMaxFiles)
+		if err != nil {
+			log.Fatalf("Failed to open event sink %s: %v", spec, err)
+		}
+		sinks.Add(sink)
+	}
+	defer sinks.Close()
+	if sinks.Len() > 0 {
+		fmt.Println("Event sinks initialized:", strings.Join(eventSinkSpecs, ", "))
+	}
+
+	// Track active and idle rooms, ending meetings that stay empty past the grace period
+	lifecycle, err := handle.NewRoomLifecycle(db, contractInstance, cloudflareService, sessions, roomIdleGrace)
+	if err != nil {
+		log.Fatalf("Failed to initialize room lifecycle: %v", err)
+	}
+	lifecycle.OnMeetingEnded(func(meeting handle.MeetingRecord) {
+		sinks.Publish(handle.NewMeetingEndedRecord(meeting))
+		if webhooks != nil {
+			if err := webhooks.Publish(handle.NewMeetingEndedWebhookEvent(meeting)); err != nil {
+				log.Printf("Error publishing meeting.ended webhook: %v", err)
+			}
+		}
+	})
+	go lifecycle.Run(ctx, 30*time.Second)
+	fmt.Println("Room lifecycle tracking started, idle grace period:", roomIdleGrace)
+
+	go reaper.Run(ctx, sessionPollInterval)
+	fmt.Println("Session reaper started, closing sessions disconnected for", sessionStaleAfter)
+
 	// Set up channel for handling OS signals
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
@@ -163,6 +431,10 @@ func main() {
 	ticker := time.NewTicker(30 * time.Second)
 	defer ticker.Stop()
 
+	// Pick up the dead letters an operator asked to retry
+	deadLetterTicker := time.NewTicker(5 * time.Second)
+	defer deadLetterTicker.Stop()
+
 	// Main event loop
 	for {
 		select {
@@ -172,7 +444,12 @@ func main() {
 
 		case event := <-participantJoinedCh:
 			log.Printf("Received ParticipantJoined event for room %s, processing...", event.RoomId)
-			eventHandler.HandleParticipantJoined(event)
+			logIndexError(indexer.IndexParticipantJoined(event))
+			projection.ApplyParticipantJoined(event)
+			logLifecycleError(lifecycle.ParticipantJoined(event.RoomId))
+			viewCache.Invalidate(event.RoomId)
+			sinks.Publish(handle.NewContractEventRecord(event))
+			handleEvent(sinks, event, func() error { return eventHandler.HandleParticipantJoined(event) })
 			queueLength := smCallManager.GetQueueLength()
 			if queueLength > 0 {
 				log.Printf("Current transaction queue length: %d", queueLength)
@@ -180,15 +457,27 @@ func main() {
 
 		case event := <-participantLeftCh:
 			log.Printf("Received ParticipantLeft event for room %s", event.RoomId)
-			eventHandler.HandleParticipantLeft(event)
+			logIndexError(indexer.IndexParticipantLeft(event))
+			projection.ApplyParticipantLeft(event)
+			logLifecycleError(lifecycle.ParticipantLeft(event.RoomId))
+			viewCache.Invalidate(event.RoomId)
+			sinks.Publish(handle.NewContractEventRecord(event))
+			handleEvent(sinks, event, func() error { return eventHandler.HandleParticipantLeft(event) })
 
 		case event := <-trackAddedCh:
 			log.Printf("Received TrackAdded event for room %s", event.RoomId)
-			eventHandler.HandleTrackAdded(event)
+			logIndexError(indexer.IndexTrackAdded(event))
+			projection.ApplyTrackAdded(event)
+			viewCache.Invalidate(event.RoomId)
+			sinks.Publish(handle.NewContractEventRecord(event))
+			handleEvent(sinks, event, func() error { return eventHandler.HandleTrackAdded(event) })
 
 		case event := <-eventToBackendCh:
 			log.Printf("Received EventForwardedToBackend for room %s", event.RoomId)
-			eventHandler.HandleEventToBackend(event)
+			logIndexError(indexer.IndexEventToBackend(event))
+			projection.ApplyEventToBackend(event)
+			sinks.Publish(handle.NewContractEventRecord(event))
+			handleEvent(sinks, event, func() error { return eventHandler.HandleEventToBackend(event) })
 			queueLength := smCallManager.GetQueueLength()
 			if queueLength > 0 {
 				log.Printf("Current transaction queue length after event processing: %d", queueLength)
@@ -198,6 +487,11 @@ func main() {
 			// Log events forwarded from backend to frontend
 			log.Printf("Event forwarded to frontend - Room: %s, Participant: %s",
 				event.RoomId, event.Participant.Hex())
+			logIndexError(indexer.IndexEventToFrontend(event))
+			projection.ApplyEventToFrontend(event)
+			// Session IDs are stored without an event, the response that follows them marks the change
+			viewCache.Invalidate(event.RoomId)
+			sinks.Publish(handle.NewContractEventRecord(event))
 
 		case <-ticker.C:
 			// Periodic health check and report queue status
@@ -207,6 +501,9 @@ func main() {
 				log.Printf("Current transaction queue length: %d", queueLength)
 			}
 
+		case <-deadLetterTicker.C:
+			eventHandler.RetryDeadLetters()
+
 		case <-sigCh:
 			fmt.Println("Received termination signal, shutting down...")
 			return
@@ -221,6 +518,30 @@ func forwardErrors(from <-chan error, to chan<- error) {
 	}
 }
 
+// logIndexError logs a failure to write an event to the index
+func logIndexError(err error) {
+	if err != nil {
+		log.Printf("Error indexing event: %v", err)
+	}
+}
+
+// logLifecycleError logs a failed room lifecycle update without interrupting event processing
+func logLifecycleError(err error) {
+	if err != nil {
+		log.Printf("Error updating room lifecycle: %v", err)
+	}
+}
+
+// handleEvent runs an event handler, logs its error and publishes the outcome to the sinks
+func handleEvent(sinks *handle.SinkGroup, event interface{}, handler func() error) {
+	start := time.Now()
+	err := handler()
+	if err != nil {
+		log.Printf("Error handling event: %v", err)
+	}
+	sinks.Publish(handle.NewHandlerOutcomeRecord(event, err, time.Since(start)))
+}
+
 // checkConnections performs a periodic health check of connections
 func checkConnections(client *ethclient.Client) {
 	// Check if we're still connected to the blockchain
@@ -835,19 +835,27 @@ class CloudflareCalls {
         try {
             console.log(`Processing pull track from queue: '${trackName}' from session ${remoteSessionId}`);
 
+            // The backend echoes this ID in the answer, so other messages forwarded to us
+            // (track announcements, chat, notices) are not taken for the pull answer
+            const requestId = `pull-${Date.now()}-${Math.random().toString(36).slice(2, 10)}`;
+
             // Set up listener for pull answer from the smart contract
-            const removeListener = SmartContractConnector.listenForEventsToFrontend(
+            const removeListener = await SmartContractConnector.listenForEventsToFrontend(
                 this.roomId,
                 async (pullAnswerData) => {
+                    if (pullAnswerData.type !== 'pull-track-response' || pullAnswerData.requestId !== requestId) {
+                        return;
+                    }
+
                     try {
                         console.log('Received pull answer from backend:', pullAnswerData);
 
-                        // if (pullAnswerData.errorCode) {
-                        //     const error = new Error(pullAnswerData.errorDescription || 'Pull track failed');
-                        //     this._error('Pull track error:', error);
-                        //     reject(error);
-                        //     return;
-                        // }
+                        if (pullAnswerData.success === false) {
+                            const error = new Error(pullAnswerData.message || 'Pull track failed');
+                            this._error('Pull track error:', error);
+                            reject(error);
+                            return;
+                        }
 
                         if (pullAnswerData.requiresImmediateRenegotiation) {
                             if (this.isRenegotiating) {
@@ -950,7 +958,8 @@ class CloudflareCalls {
                 this.roomId,
                 this.sessionId,
                 remoteSessionId,
-                trackName
+                trackName,
+                requestId
             );
 
         } catch (error) {
@@ -548,8 +548,11 @@ class SmartContractConnector {
                     sessionId: participant.sessionID || 'unknown-session',
                     name: participant.name || 'Anonymous',
                     walletAddress: participant.walletAddress,
-                    // Map tracks to publishedTracks array
-                    publishedTracks: participant.tracks.map(track => track.trackName).filter(name => name !== '')
+                    // Map media tracks to publishedTracks array; data channels are subscribed to, not pulled
+                    publishedTracks: participant.tracks
+                        .filter(track => track.location !== 'datachannel')
+                        .map(track => track.trackName)
+                        .filter(name => name !== '')
                 };
             });
 
@@ -574,8 +577,9 @@ class SmartContractConnector {
      * @param {string} sessionId - Current user's session ID
      * @param {string} remoteSessionId - Remote participant's session ID
      * @param {string} trackName - Track name to pull
+     * @param {string} requestId - ID echoed in the pull-track-response
      */
-    async pullTracksCompressed(roomId, sessionId, remoteSessionId, trackName) {
+    async pullTracksCompressed(roomId, sessionId, remoteSessionId, trackName, requestId) {
         await this.ensureInitialized();
 
         try {
@@ -592,6 +596,7 @@ class SmartContractConnector {
             // Create event data
             const eventData = ethers.utils.toUtf8Bytes(JSON.stringify({
                 type: "pull-track",
+                requestId,
                 sessionId,
                 remoteSessionId,
                 compressedData,